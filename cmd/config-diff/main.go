@@ -0,0 +1,73 @@
+// config-diff loads two configs through the full merge and finalize pipeline and prints their differences,
+// with secrets masked. It exits with 0 if the configs are equivalent, 1 if they differ and 2 on error
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/densify-dev/container-config/config"
+	"github.com/spf13/pflag"
+)
+
+const (
+	formatText = "text"
+	formatJson = "json"
+)
+
+func main() {
+	fs := pflag.NewFlagSet("config-diff", pflag.ExitOnError)
+	format := fs.String("format", formatText, "output format - text or json")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "usage: config-diff [--format text|json] <old config> <new config>\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(os.Args[1:])
+	if fs.NArg() != 2 || (*format != formatText && *format != formatJson) {
+		fs.Usage()
+		os.Exit(2)
+	}
+	changes, err := diff(fs.Arg(0), fs.Arg(1))
+	if err == nil {
+		err = printChanges(changes, *format)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "config-diff: %v\n", err)
+		os.Exit(2)
+	}
+	if len(changes) > 0 {
+		os.Exit(1)
+	}
+}
+
+func diff(oldPath, newPath string) (changes []config.Change, err error) {
+	var a, b *config.Parameters
+	if a, err = config.LoadFile(oldPath); err != nil {
+		err = fmt.Errorf("%s: %w", oldPath, err)
+		return
+	}
+	if b, err = config.LoadFile(newPath); err != nil {
+		err = fmt.Errorf("%s: %w", newPath, err)
+		return
+	}
+	changes = config.Diff(a, b)
+	return
+}
+
+func printChanges(changes []config.Change, format string) error {
+	if format == formatJson {
+		if changes == nil {
+			changes = []config.Change{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(changes)
+	}
+	for _, c := range changes {
+		if _, err := fmt.Println(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+// config-validate loads a config through the full pipeline and runs all its validations, without contacting
+// any network service (a remote config is only read from its cache). It exits with 0 if the config is valid,
+// 1 if it is not and 2 on usage errors
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/densify-dev/container-config/config"
+	"github.com/spf13/pflag"
+)
+
+const (
+	formatText = "text"
+	formatJson = "json"
+)
+
+// Message is an error or a warning, at its position if it is known: File is the config file (or overlay,
+// or remote config URL) it was read from and Line its line there, 0 if unknown
+type Message struct {
+	Message string `json:"message"`
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+}
+
+// Plan is the collection plan of a cluster with its own collection parameters, or the global one if
+// Cluster is empty
+type Plan struct {
+	Cluster string `json:"cluster,omitempty"`
+	*config.CollectionPlan
+}
+
+// Result is the outcome of validating a config file
+type Result struct {
+	File     string    `json:"file"`
+	Valid    bool      `json:"valid"`
+	Errors   []Message `json:"errors"`
+	Warnings []Message `json:"warnings"`
+	Plans    []Plan    `json:"plans,omitempty"`
+}
+
+func main() {
+	fs := pflag.NewFlagSet("config-validate", pflag.ExitOnError)
+	format := fs.String("format", formatText, "output format - text or json")
+	envFiles := fs.StringArray("env-file", nil, "file of KEY=VALUE environment variables to set before loading the config (may be repeated)")
+	overlays := fs.StringArray("overlay", nil, "yaml config file to deep-merge on top of the config (may be repeated)")
+	profile := fs.String("profile", "", "name of the yaml config profile to merge on top of the config")
+	strict := fs.Bool("strict", false, "reject unknown fields")
+	plan := fs.Bool("plan", false, "print the collection plan - number of queries, points per series and lookback")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "usage: config-validate [flags] <config>\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(os.Args[1:])
+	if fs.NArg() != 1 || (*format != formatText && *format != formatJson) {
+		fs.Usage()
+		os.Exit(2)
+	}
+	res := &Result{File: fs.Arg(0), Errors: []Message{}, Warnings: []Message{}}
+	slog.SetDefault(slog.New(&warningHandler{res: res}))
+	err := loadEnvFiles(*envFiles)
+	// the overlays of the command line are relative to the working directory, not to the config file
+	for i := 0; err == nil && i < len(*overlays); i++ {
+		(*overlays)[i], err = filepath.Abs((*overlays)[i])
+	}
+	if err == nil {
+		opts := []config.Option{config.WithOffline(), config.WithOverlays(*overlays...), config.WithProfile(*profile)}
+		if *strict {
+			opts = append(opts, config.WithStrict())
+		}
+		var p *config.Parameters
+		if p, err = config.LoadFile(res.File, opts...); err == nil && *plan {
+			res.Plans = plans(p)
+		}
+	}
+	if err != nil {
+		res.Errors = append(res.Errors, messages(err)...)
+	}
+	res.Valid = len(res.Errors) == 0
+	if err = printResult(res, *format); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "config-validate: %v\n", err)
+		os.Exit(2)
+	}
+	if !res.Valid {
+		os.Exit(1)
+	}
+}
+
+// messages returns a message for each of the errors joined in err (e.g. each unknown field), positioned if
+// it is a config.PositionError
+func messages(err error) (ms []Message) {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			ms = append(ms, messages(e)...)
+		}
+		return
+	}
+	if pe, ok := err.(*config.PositionError); ok {
+		return []Message{{Message: pe.Err.Error(), File: pe.File, Line: pe.Line}}
+	}
+	return []Message{{Message: err.Error()}}
+}
+
+// plans returns the global collection plan, followed by the plans of the clusters with their own collection
+// parameters
+func plans(p *config.Parameters) (ps []Plan) {
+	// the collection parameters are finalized, so their plans are valid
+	global, _ := p.Collection.Plan()
+	ps = append(ps, Plan{CollectionPlan: global})
+	for _, cfp := range p.Clusters {
+		if cfp != nil && cfp.Collection != nil {
+			cp, _ := p.CollectionFor(cfp.Name).Plan()
+			ps = append(ps, Plan{Cluster: cfp.Name, CollectionPlan: cp})
+		}
+	}
+	return
+}
+
+// loadEnvFiles sets the environment variables of files in the KEY=VALUE format; empty lines and lines
+// starting with '#' are skipped, and a leading "export " and quotes around the value are removed
+func loadEnvFiles(paths []string) error {
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(f)
+		for n := 1; scanner.Scan(); n++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+			if key = strings.TrimSpace(key); !ok || key == "" {
+				err = fmt.Errorf("%s:%d: invalid line, must be KEY=VALUE", path, n)
+				break
+			}
+			value = strings.TrimSpace(value)
+			if uq, e := strconv.Unquote(value); e == nil {
+				value = uq
+			} else if len(value) > 1 && value[0] == '\'' && value[len(value)-1] == '\'' {
+				value = value[1 : len(value)-1]
+			}
+			if err = os.Setenv(key, value); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = scanner.Err()
+		}
+		_ = f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func printResult(res *Result, format string) (err error) {
+	if format == formatJson {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	}
+	for _, w := range res.Warnings {
+		if _, err = fmt.Printf("%swarning: %s\n", position(w), w.Message); err != nil {
+			return
+		}
+	}
+	for _, e := range res.Errors {
+		if _, err = fmt.Printf("%serror: %s\n", position(e), e.Message); err != nil {
+			return
+		}
+	}
+	if res.Valid {
+		_, err = fmt.Printf("%s: valid\n", res.File)
+	}
+	for _, p := range res.Plans {
+		title := "collection plan"
+		if p.Cluster != "" {
+			title += " of cluster " + p.Cluster
+		}
+		if err == nil {
+			_, err = fmt.Printf("\n%s:\n%s", title, p.CollectionPlan)
+		}
+	}
+	return
+}
+
+// position is the prefix of a message with a known position, empty otherwise
+func position(m Message) string {
+	switch {
+	case m.Line > 0:
+		return fmt.Sprintf("%s:%d: ", m.File, m.Line)
+	case m.File != "":
+		return m.File + ": "
+	}
+	return ""
+}
+
+// warningHandler collects the warnings logged while loading the config
+type warningHandler struct {
+	res   *Result
+	attrs []slog.Attr
+}
+
+func (h *warningHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn
+}
+
+func (h *warningHandler) Handle(_ context.Context, r slog.Record) error {
+	var sb strings.Builder
+	sb.WriteString(r.Message)
+	appendAttr := func(a slog.Attr) bool {
+		_, _ = fmt.Fprintf(&sb, " %s=%v", a.Key, a.Value)
+		return true
+	}
+	for _, a := range h.attrs {
+		appendAttr(a)
+	}
+	r.Attrs(appendAttr)
+	msg := Message{Message: sb.String()}
+	if r.Level >= slog.LevelError {
+		h.res.Errors = append(h.res.Errors, msg)
+	} else {
+		h.res.Warnings = append(h.res.Warnings, msg)
+	}
+	return nil
+}
+
+func (h *warningHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &warningHandler{res: h.res, attrs: append(append([]slog.Attr{}, h.attrs...), attrs...)}
+}
+
+func (h *warningHandler) WithGroup(string) slog.Handler {
+	return h
+}
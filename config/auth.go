@@ -0,0 +1,284 @@
+package config
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// auth types
+const (
+	AuthBasic       = "basic"
+	AuthToken       = "token"
+	AuthJwtExchange = "jwt-exchange"
+)
+
+const (
+	// DefaultSubjectTokenType is the RFC 8693 type of a JWT subject token
+	DefaultSubjectTokenType = "urn:ietf:params:oauth:token-type:jwt"
+	grantTokenExchange      = "urn:ietf:params:oauth:grant-type:token-exchange"
+	grantClientCredentials  = "client_credentials"
+	// tokenMaxSize bounds the size of a token endpoint response
+	tokenMaxSize = 1 << 20
+	// tokenExpiryWarning is how long before a token expires a warning is logged
+	tokenExpiryWarning = 24 * time.Hour
+)
+
+// BasicAuth authenticates with a username and a password (or an encrypted password)
+type BasicAuth struct {
+	Username          string `yaml:"username"`
+	Password          string `yaml:"password,omitempty"`
+	EncryptedPassword string `yaml:"encrypted_password,omitempty"`
+}
+
+// TokenAuth authenticates with a scoped API token - value or filename
+type TokenAuth struct {
+	Token string `yaml:"token"`
+}
+
+// JwtExchangeAuth authenticates with a JWT obtained from a token endpoint (RFC 8693 token exchange or
+// client credentials); ClientSecret and SubjectToken (e.g. a service account token) are values or filenames
+type JwtExchangeAuth struct {
+	TokenUrl         string `yaml:"token_url"`
+	ClientId         string `yaml:"client_id"`
+	ClientSecret     string `yaml:"client_secret,omitempty"`
+	SubjectToken     string `yaml:"subject_token,omitempty"`
+	SubjectTokenType string `yaml:"subject_token_type,omitempty"`
+	Audience         string `yaml:"audience,omitempty"`
+	Scope            string `yaml:"scope,omitempty"`
+}
+
+// DensifyAuth is the authentication of a Densify instance; exactly one of Basic, Token and JwtExchange
+// is set, Type is inferred from it if omitted. If there is no auth section, the credentials of the url
+// (if any) are used for basic authentication
+type DensifyAuth struct {
+	Type        string           `yaml:"type,omitempty"`
+	Basic       *BasicAuth       `yaml:"basic,omitempty"`
+	Token       *TokenAuth       `yaml:"token,omitempty"`
+	JwtExchange *JwtExchangeAuth `yaml:"jwt_exchange,omitempty"`
+}
+
+func (da *DensifyAuth) typ() (typ string, err error) {
+	var types []string
+	if da.Basic != nil {
+		types = append(types, AuthBasic)
+	}
+	if da.Token != nil {
+		types = append(types, AuthToken)
+	}
+	if da.JwtExchange != nil {
+		types = append(types, AuthJwtExchange)
+	}
+	switch len(types) {
+	case 0:
+		err = fmt.Errorf("one of basic, token or jwt_exchange must be set")
+	case 1:
+		typ = types[0]
+		if da.Type != Empty && !strings.EqualFold(da.Type, typ) {
+			err = fmt.Errorf("type %s does not match the %s section", da.Type, typ)
+		}
+	default:
+		err = fmt.Errorf("only one of %s may be set", strings.Join(types, ", "))
+	}
+	return
+}
+
+// finalizeAuth validates the auth section; the url credentials are migrated to a basic auth section,
+// and the credentials of a basic auth section are set on the url
+func (dp *DensifyParameters) finalizeAuth() (err error) {
+	uc := dp.UrlConfig
+	urlCreds := uc != nil && (uc.Username != Empty || uc.Password != Empty || uc.EncryptedPassword != Empty)
+	if dp.Auth == nil || dp.implicitAuth {
+		dp.Auth = nil
+		if dp.implicitAuth = urlCreds; urlCreds {
+			dp.Auth = &DensifyAuth{Type: AuthBasic, Basic: &BasicAuth{Username: uc.Username, Password: uc.Password, EncryptedPassword: uc.EncryptedPassword}}
+		}
+		return
+	}
+	if dp.Auth.Type, err = dp.Auth.typ(); err == nil {
+		switch dp.Auth.Type {
+		case AuthBasic:
+			if err = dp.Auth.Basic.validate(); err == nil && uc != nil {
+				if urlCreds && *dp.Auth.Basic != (BasicAuth{Username: uc.Username, Password: uc.Password, EncryptedPassword: uc.EncryptedPassword}) {
+					err = fmt.Errorf("credentials are set in both the url and the basic auth section")
+				} else {
+					uc.Username, uc.Password, uc.EncryptedPassword = dp.Auth.Basic.Username, dp.Auth.Basic.Password, dp.Auth.Basic.EncryptedPassword
+				}
+			}
+		case AuthToken, AuthJwtExchange:
+			if urlCreds {
+				err = fmt.Errorf("url credentials and %s auth are mutually exclusive", dp.Auth.Type)
+			} else if dp.Auth.Type == AuthToken {
+				err = dp.Auth.Token.validate()
+			} else {
+				err = dp.Auth.JwtExchange.validate()
+			}
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("invalid densify auth: %w", err)
+	}
+	return
+}
+
+func (ba *BasicAuth) validate() error {
+	switch {
+	case ba.Username == Empty:
+		return fmt.Errorf("basic auth username must be set")
+	case ba.Password == Empty && ba.EncryptedPassword == Empty:
+		return fmt.Errorf("basic auth password or encrypted_password must be set")
+	case ba.Password != Empty && ba.EncryptedPassword != Empty:
+		return fmt.Errorf("basic auth password and encrypted_password are mutually exclusive")
+	}
+	return nil
+}
+
+// Value returns the token, read from its file (if it is a filename)
+func (ta *TokenAuth) Value() (string, error) {
+	return readSecret(ta.Token)
+}
+
+// ExpiresAt returns the expiry time of the token, ok is false if the token is not a JWT or has no expiry
+func (ta *TokenAuth) ExpiresAt() (t time.Time, ok bool, err error) {
+	var s string
+	if s, err = ta.Value(); err == nil {
+		t, ok = jwtExpiry(s)
+	}
+	return
+}
+
+func (ta *TokenAuth) validate() error {
+	if ta.Token == Empty {
+		return fmt.Errorf("token must be set")
+	}
+	t, ok, err := ta.ExpiresAt()
+	if err == nil && ok {
+		err = checkExpiry(AuthToken, t)
+	}
+	return err
+}
+
+func (je *JwtExchangeAuth) validate() (err error) {
+	var u *url.URL
+	switch {
+	case je.TokenUrl == Empty:
+		err = fmt.Errorf("jwt_exchange token_url must be set")
+	case je.ClientId == Empty:
+		err = fmt.Errorf("jwt_exchange client_id must be set")
+	case je.ClientSecret == Empty && je.SubjectToken == Empty:
+		err = fmt.Errorf("jwt_exchange client_secret or subject_token must be set")
+	case je.SubjectToken == Empty && je.SubjectTokenType != Empty:
+		err = fmt.Errorf("jwt_exchange subject_token_type requires subject_token")
+	}
+	if err != nil {
+		return
+	}
+	if u, err = url.Parse(je.TokenUrl); err != nil || (u.Scheme != Http && u.Scheme != Https) || u.Host == Empty {
+		return fmt.Errorf("invalid jwt_exchange token_url %s: must be an absolute http(s) url", je.TokenUrl)
+	}
+	if je.SubjectToken != Empty {
+		if je.SubjectTokenType == Empty {
+			je.SubjectTokenType = DefaultSubjectTokenType
+		}
+		var s string
+		if s, err = readSecret(je.SubjectToken); err == nil {
+			if t, ok := jwtExpiry(s); ok {
+				err = checkExpiry("jwt_exchange subject_token", t)
+			}
+		}
+	}
+	return
+}
+
+// Exchange obtains a JWT from the token endpoint with client (http.DefaultClient if nil): by RFC 8693
+// token exchange if there is a subject token, with client credentials otherwise
+func (je *JwtExchangeAuth) Exchange(ctx context.Context, client *http.Client) (token string, err error) {
+	form := url.Values{"client_id": {je.ClientId}, "grant_type": {grantClientCredentials}}
+	if je.ClientSecret != Empty {
+		var secret string
+		if secret, err = readSecret(je.ClientSecret); err != nil {
+			return
+		}
+		form.Set("client_secret", secret)
+	}
+	if je.SubjectToken != Empty {
+		var subject string
+		if subject, err = readSecret(je.SubjectToken); err != nil {
+			return
+		}
+		form.Set("grant_type", grantTokenExchange)
+		form.Set("subject_token", subject)
+		form.Set("subject_token_type", cmp.Or(je.SubjectTokenType, DefaultSubjectTokenType))
+	}
+	if je.Audience != Empty {
+		form.Set("audience", je.Audience)
+	}
+	if je.Scope != Empty {
+		form.Set("scope", je.Scope)
+	}
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, http.MethodPost, je.TokenUrl, strings.NewReader(form.Encode())); err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if client == nil {
+		client = http.DefaultClient
+	}
+	var resp *http.Response
+	if resp, err = client.Do(req); err != nil {
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("token endpoint %s: %s", je.TokenUrl, resp.Status)
+		return
+	}
+	var body struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, tokenMaxSize)).Decode(&body); err == nil && body.AccessToken == Empty {
+		err = fmt.Errorf("token endpoint %s: no access_token in response", je.TokenUrl)
+	}
+	token = body.AccessToken
+	return
+}
+
+func readSecret(s string) (string, error) {
+	vop, err := NewValueOrPath(s, false, true)
+	if err != nil {
+		return Empty, err
+	}
+	return strings.TrimSpace(vop.Value()), nil
+}
+
+// jwtExpiry returns the expiry time of s, ok is false if s is not a JWT or has no expiry; the signature
+// is not verified, as only the issuer can do that
+func jwtExpiry(s string) (t time.Time, ok bool) {
+	token, _, err := jwt.NewParser().ParseUnverified(s, jwt.MapClaims{})
+	if err != nil {
+		return
+	}
+	if exp, e := token.Claims.GetExpirationTime(); e == nil && exp != nil {
+		t, ok = exp.Time, true
+	}
+	return
+}
+
+func checkExpiry(name string, t time.Time) error {
+	switch left := time.Until(t); {
+	case left <= 0:
+		return fmt.Errorf("%s expired at %v", name, t)
+	case left < tokenExpiryWarning:
+		slog.Warn("token expires soon", "token", name, "expiresAt", t)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signedJwt returns a JWT expiring at exp
+func signedJwt(t *testing.T, exp time.Time) string {
+	t.Helper()
+	s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"exp": exp.Unix()}).SignedString([]byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestFinalizeAuth(t *testing.T) {
+	expired, soon, later := signedJwt(t, time.Now().Add(-time.Hour)), signedJwt(t, time.Now().Add(time.Hour)), signedJwt(t, time.Now().Add(48*time.Hour))
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte(expired), 0600); err != nil {
+		t.Fatal(err)
+	}
+	exchange := func(je JwtExchangeAuth) *DensifyAuth { return &DensifyAuth{JwtExchange: &je} }
+	tests := []struct {
+		name   string
+		user   string
+		auth   *DensifyAuth
+		typ    string
+		warned bool
+		err    string
+	}{
+		{name: "no credentials"},
+		{name: "url credentials", user: "u", typ: AuthBasic},
+		{name: "basic", auth: &DensifyAuth{Basic: &BasicAuth{Username: "u", Password: "p"}}, typ: AuthBasic},
+		{name: "basic matching the url", user: "u", auth: &DensifyAuth{Basic: &BasicAuth{Username: "u", Password: "p"}}, typ: AuthBasic},
+		{name: "basic and other url credentials", user: "v", auth: &DensifyAuth{Basic: &BasicAuth{Username: "u", Password: "p"}}, err: "both the url and the basic auth section"},
+		{name: "basic without password", auth: &DensifyAuth{Basic: &BasicAuth{Username: "u"}}, err: "password or encrypted_password must be set"},
+		{name: "basic with both passwords", auth: &DensifyAuth{Basic: &BasicAuth{Username: "u", Password: "p", EncryptedPassword: "e"}}, err: "mutually exclusive"},
+		{name: "token", auth: &DensifyAuth{Token: &TokenAuth{Token: "opaque"}}, typ: AuthToken},
+		{name: "token and url credentials", user: "u", auth: &DensifyAuth{Token: &TokenAuth{Token: "opaque"}}, err: "url credentials and token auth are mutually exclusive"},
+		{name: "basic and token", auth: &DensifyAuth{Basic: &BasicAuth{Username: "u", Password: "p"}, Token: &TokenAuth{Token: "opaque"}}, err: "only one of basic, token may be set"},
+		{name: "type mismatch", auth: &DensifyAuth{Type: AuthBasic, Token: &TokenAuth{Token: "opaque"}}, err: "does not match"},
+		{name: "no section", auth: &DensifyAuth{Type: AuthToken}, err: "one of basic, token or jwt_exchange must be set"},
+		{name: "empty token", auth: &DensifyAuth{Token: &TokenAuth{}}, err: "token must be set"},
+		{name: "expired jwt", auth: &DensifyAuth{Token: &TokenAuth{Token: expired}}, err: "token expired"},
+		{name: "expired jwt file", auth: &DensifyAuth{Token: &TokenAuth{Token: tokenFile}}, err: "token expired"},
+		{name: "jwt expiring within a day", auth: &DensifyAuth{Token: &TokenAuth{Token: soon}}, typ: AuthToken, warned: true},
+		{name: "jwt expiring later", auth: &DensifyAuth{Token: &TokenAuth{Token: later}}, typ: AuthToken},
+		{name: "jwt exchange", auth: exchange(JwtExchangeAuth{TokenUrl: "https://idp/token", ClientId: "c", ClientSecret: "s"}), typ: AuthJwtExchange},
+		{name: "jwt exchange and url credentials", user: "u", auth: exchange(JwtExchangeAuth{TokenUrl: "https://idp/token", ClientId: "c", ClientSecret: "s"}), err: "url credentials and jwt-exchange auth are mutually exclusive"},
+		{name: "jwt exchange without secret", auth: exchange(JwtExchangeAuth{TokenUrl: "https://idp/token", ClientId: "c"}), err: "client_secret or subject_token must be set"},
+		{name: "jwt exchange relative url", auth: exchange(JwtExchangeAuth{TokenUrl: "/token", ClientId: "c", ClientSecret: "s"}), err: "must be an absolute http(s) url"},
+		{name: "jwt exchange subject token type alone", auth: exchange(JwtExchangeAuth{TokenUrl: "https://idp/token", ClientId: "c", ClientSecret: "s", SubjectTokenType: DefaultSubjectTokenType}), err: "requires subject_token"},
+		{name: "jwt exchange expired subject token", auth: exchange(JwtExchangeAuth{TokenUrl: "https://idp/token", ClientId: "c", SubjectToken: expired}), err: "subject_token expired"},
+		{name: "jwt exchange subject token expiring within a day", auth: exchange(JwtExchangeAuth{TokenUrl: "https://idp/token", ClientId: "c", SubjectToken: soon}), typ: AuthJwtExchange, warned: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			uc := &UrlConfig{Host: "densify.com", Username: tt.user}
+			if tt.user != Empty {
+				uc.Password = "p"
+			}
+			dp := &DensifyParameters{UrlConfig: uc, Auth: tt.auth}
+			err := dp.finalize()
+			if tt.err != Empty {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var typ string
+			if dp.Auth != nil {
+				typ = dp.Auth.Type
+			}
+			if typ != tt.typ {
+				t.Errorf("got auth type %q, want %q", typ, tt.typ)
+			}
+			// the basic credentials are those of the url
+			if typ == AuthBasic && (dp.Auth.Basic.Username != dp.UrlConfig.Username || dp.Auth.Basic.Password != dp.UrlConfig.Password) {
+				t.Errorf("got basic auth %+v and url credentials %s", dp.Auth.Basic, dp.UrlConfig.Username)
+			}
+			if warned := strings.Contains(logs.String(), "token expires soon"); warned != tt.warned {
+				t.Errorf("warning logged: %t, want %t", warned, tt.warned)
+			}
+		})
+	}
+}
+
+func TestTokenExpiresAt(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	if got, ok, err := (&TokenAuth{Token: signedJwt(t, exp)}).ExpiresAt(); err != nil || !ok || !got.Equal(exp) {
+		t.Errorf("got %v, %t, %v, want %v", got, ok, err, exp)
+	}
+	// not a jwt, a jwt without expiry
+	noExp, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "s"}).SignedString([]byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{"opaque", noExp} {
+		if _, ok, err := (&TokenAuth{Token: token}).ExpiresAt(); err != nil || ok {
+			t.Errorf("got %t, %v", ok, err)
+		}
+	}
+}
+
+func TestExchange(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretFile, []byte("file-secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		je     JwtExchangeAuth
+		status int
+		body   string
+		want   map[string]string
+		err    string
+	}{
+		{name: "client credentials", je: JwtExchangeAuth{ClientId: "c", ClientSecret: secretFile, Scope: "upload"}, body: `{"access_token": "at", "token_type": "Bearer"}`,
+			want: map[string]string{"grant_type": grantClientCredentials, "client_id": "c", "client_secret": "file-secret", "scope": "upload", "subject_token": Empty}},
+		{name: "token exchange", je: JwtExchangeAuth{ClientId: "c", SubjectToken: "sa-token", Audience: "densify"}, body: `{"access_token": "at"}`,
+			want: map[string]string{"grant_type": grantTokenExchange, "subject_token": "sa-token", "subject_token_type": DefaultSubjectTokenType, "audience": "densify", "client_secret": Empty}},
+		{name: "custom subject token type", je: JwtExchangeAuth{ClientId: "c", SubjectToken: "sa-token", SubjectTokenType: "urn:x"}, body: `{"access_token": "at"}`,
+			want: map[string]string{"subject_token_type": "urn:x"}},
+		{name: "rejected", je: JwtExchangeAuth{ClientId: "c", ClientSecret: "s"}, status: http.StatusUnauthorized, err: "401"},
+		{name: "no access token", je: JwtExchangeAuth{ClientId: "c", ClientSecret: "s"}, body: `{"error": "x"}`, err: "no access_token"},
+		{name: "invalid response", je: JwtExchangeAuth{ClientId: "c", ClientSecret: "s"}, body: `<html>`, err: "invalid character"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				if err := r.ParseForm(); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				for k, v := range tt.want {
+					if got := r.PostForm.Get(k); got != v {
+						t.Errorf("got %s %q, want %q", k, got, v)
+					}
+				}
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			je := tt.je
+			je.TokenUrl = srv.URL + "/token"
+			token, err := je.Exchange(context.Background(), srv.Client())
+			if tt.err != Empty {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil || token != "at" {
+				t.Errorf("got %q, %v", token, err)
+			}
+		})
+	}
+}
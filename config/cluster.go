@@ -0,0 +1,221 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// cluster metadata bounds
+const (
+	maxTags              = 50
+	maxTagKeyLength      = 63
+	maxTagValueLength    = 256
+	maxDisplayNameLength = 256
+	maxDescriptionLength = 1024
+)
+
+var tagKeyPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]*$`)
+
+// Tag is a cluster tag, see ClusterFilterParameters.TagList
+type Tag struct {
+	Key   string `yaml:"key" json:"key"`
+	Value string `yaml:"value" json:"value"`
+}
+
+// TagList returns the tags sorted by key, a stable order for serialization
+func (cfp *ClusterFilterParameters) TagList() []Tag {
+	tags := make([]Tag, 0, len(cfp.Tags))
+	for k, v := range cfp.Tags {
+		tags = append(tags, Tag{Key: k, Value: v})
+	}
+	slices.SortFunc(tags, func(a, b Tag) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return tags
+}
+
+// parseTags parses a comma-separated list of key=value tags; an entry without '=' is a key with an
+// empty value, which validate reports
+func parseTags(s string) (tags map[string]string) {
+	for _, entry := range strings.Split(s, Comma) {
+		if entry = strings.TrimSpace(entry); entry == Empty {
+			continue
+		}
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+		k, v, _ := strings.Cut(entry, "=")
+		tags[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return
+}
+
+func (cfp *ClusterFilterParameters) validate() error {
+	switch {
+	case len(cfp.DisplayName) > maxDisplayNameLength:
+		return fmt.Errorf("display_name is longer than %d characters", maxDisplayNameLength)
+	case len(cfp.Description) > maxDescriptionLength:
+		return fmt.Errorf("description is longer than %d characters", maxDescriptionLength)
+	case len(cfp.Tags) > maxTags:
+		return fmt.Errorf("%d tags exceed %d", len(cfp.Tags), maxTags)
+	}
+	for _, tag := range cfp.TagList() {
+		switch {
+		case len(tag.Key) > maxTagKeyLength || !tagKeyPattern.MatchString(tag.Key):
+			return fmt.Errorf("invalid tag key %q: must start with a letter, contain only letters, digits, '_', '.' and '-' and be at most %d characters", tag.Key, maxTagKeyLength)
+		case tag.Value == Empty:
+			return fmt.Errorf("tag %s has no value", tag.Key)
+		case len(tag.Value) > maxTagValueLength:
+			return fmt.Errorf("value of tag %s is longer than %d characters", tag.Key, maxTagValueLength)
+		}
+	}
+	return nil
+}
+
+// setCluster applies the cluster keys on top of the config: the metadata of cfp is set on the cluster of the
+// same name (or on the only cluster, if cfp has no name), otherwise cfp is added as a new cluster
+func (p *Parameters) setCluster(cfp *ClusterFilterParameters) error {
+	var target *ClusterFilterParameters
+	for _, c := range p.Clusters {
+		if c != nil && (c.Name == cfp.Name || cfp.Name == Empty && len(p.Clusters) == 1) {
+			target = c
+			break
+		}
+	}
+	switch {
+	case target != nil:
+	case cfp.Name == Empty:
+		return fmt.Errorf("%s is required with the cluster metadata keys, unless the config has a single cluster", clusterName)
+	default:
+		p.Clusters = append(p.Clusters, cfp)
+		return nil
+	}
+	if cfp.DisplayName != Empty {
+		target.DisplayName = cfp.DisplayName
+	}
+	if cfp.Description != Empty {
+		target.Description = cfp.Description
+	}
+	if cfp.Tags != nil {
+		target.Tags = cfp.Tags
+	}
+	return nil
+}
+
+// validateClusters validates the metadata of each cluster, and that the names of the clusters are unique, as
+// clusters are told apart by name (e.g. by CollectionFor and Diff)
+func (p *Parameters) validateClusters() error {
+	names := make(map[string]bool, len(p.Clusters))
+	for i, cfp := range p.Clusters {
+		if cfp == nil {
+			continue
+		}
+		err := cfp.validate()
+		if err == nil && cfp.Name != Empty {
+			if names[cfp.Name] {
+				err = fmt.Errorf("duplicate cluster name")
+			}
+			names[cfp.Name] = true
+		}
+		if err != nil {
+			return atField(fmt.Errorf("cluster %s: %w", cfp.Name, err), "clusters", strconv.Itoa(i))
+		}
+	}
+	return nil
+}
+
+// CollectionFor returns the effective collection parameters of cluster: a deep copy of the global ones, with
+// the fields set in the collection section of the cluster (if any) replaced, see CollectionOverrides. The
+// copy is the caller's, whether or not the cluster has overrides or is known
+func (p *Parameters) CollectionFor(cluster string) *CollectionParameters {
+	for _, cfp := range p.Clusters {
+		if cfp == nil || cfp.Name != cluster {
+			continue
+		}
+		if cfp.collection != nil {
+			return cfp.collection.clone()
+		}
+		if cfp.Collection != nil {
+			return cfp.Collection.apply(p.Collection)
+		}
+		break
+	}
+	if p.Collection == nil {
+		return nil
+	}
+	return p.Collection.clone()
+}
+
+// finalizeClusterCollections finalizes the collection parameters of each cluster, logging the soft limits
+// they exceed unless the global collection parameters (whose warnings are given) exceed them too
+func (p *Parameters) finalizeClusterCollections(warnings []string) error {
+	for i, cfp := range p.Clusters {
+		if cfp == nil || cfp.Collection == nil {
+			continue
+		}
+		cp := cfp.Collection.apply(p.Collection)
+		cw, err := cp.finalize()
+		if err != nil {
+			return atField(fmt.Errorf("cluster %s: %w", cfp.Name, err), "clusters", strconv.Itoa(i), "collection")
+		}
+		for _, w := range cw {
+			if !slices.Contains(warnings, w) {
+				slog.Warn("collection window exceeds soft limit", "cluster", cfp.Name, "limit", w)
+			}
+		}
+		cfp.collection = cp
+	}
+	return nil
+}
+
+// apply returns a deep copy of global with the fields set in co replaced by deep copies of them
+func (co *CollectionOverrides) apply(global *CollectionParameters) *CollectionParameters {
+	cp := global.clone()
+	if co.Include != nil {
+		cp.Include = maps.Clone(co.Include)
+	}
+	overrideValue(&cp.Interval, co.Interval)
+	overrideValue(&cp.IntervalSize, co.IntervalSize)
+	overrideValue(&cp.History, co.History)
+	overrideValue(&cp.Offset, co.Offset)
+	overrideValue(&cp.SampleRate, co.SampleRate)
+	overrideList(&cp.NodeGroupList, co.NodeGroupList)
+	overrideList(&cp.NodeGroupListExtra, co.NodeGroupListExtra)
+	overrideList(&cp.RoleList, co.RoleList)
+	if co.Limits != nil {
+		cp.Limits = co.Limits.clone()
+	}
+	if co.Schedule != nil {
+		cp.Schedule = co.Schedule.clone()
+	}
+	return cp
+}
+
+func overrideValue[T any](target, override *T) {
+	if override != nil {
+		*target = *override
+	}
+}
+
+func overrideList(target, override *StringList) {
+	if override != nil {
+		*target = slices.Clone(*override)
+	}
+}
+
+// clone returns a deep copy of cp
+func (cp *CollectionParameters) clone() *CollectionParameters {
+	c := *cp
+	c.Include = maps.Clone(cp.Include)
+	c.NodeGroupList = slices.Clone(cp.NodeGroupList)
+	c.NodeGroupListExtra = slices.Clone(cp.NodeGroupListExtra)
+	c.RoleList = slices.Clone(cp.RoleList)
+	c.Limits = cp.Limits.clone()
+	c.Schedule = cp.Schedule.clone()
+	return &c
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollectionFor(t *testing.T) {
+	yamlDoc := baseYaml + `    collection:
+      offset: 0
+      node_group_list: []
+  - name: c1
+    collection:
+      history: 2
+      role_list: [worker]
+collection:
+  offset: 2
+  node_group_list: [label_a]
+  include:
+    node: true
+`
+	p, err := loadDir(t, map[string]string{"config.yaml": yamlDoc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c0, c1 := p.CollectionFor("c0"), p.CollectionFor("c1")
+	// zero values override the global ones, fields not set keep them
+	if c0.Offset != 0 || len(c0.NodeGroupList) != 0 || c0.History != p.Collection.History {
+		t.Errorf("c0: got offset %d, node group list %v, history %d", c0.Offset, c0.NodeGroupList, c0.History)
+	}
+	if c1.Offset != 2 || c1.History != 2 || !reflect.DeepEqual(c1.RoleList, StringList{"worker"}) {
+		t.Errorf("c1: got offset %d, history %d, role list %v", c1.Offset, c1.History, c1.RoleList)
+	}
+	// the effective parameters share no map or list with the global ones nor with the overrides
+	c1.Include["pod"] = true
+	c1.NodeGroupList[0] = "label_x"
+	c1.RoleList[0] = "master"
+	if p.Collection.Include["pod"] || p.Collection.NodeGroupList[0] != "label_a" || (*p.Clusters[1].Collection.RoleList)[0] != "worker" {
+		t.Error("the cluster collection parameters are shared")
+	}
+	// the overrides read back from the encoded config
+	b, err := p.Encode(FormatYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := LoadFromReader(bytes.NewReader(b), FormatYaml)
+	if err != nil {
+		t.Fatalf("%v:\n%s", err, b)
+	}
+	if changes := Diff(p, q); len(changes) > 0 {
+		t.Errorf("encoded config differs: %v", changes)
+	}
+}
+
+func TestCollectionOverridesFields(t *testing.T) {
+	ot := reflect.TypeOf(CollectionOverrides{})
+	for i := 0; i < ot.NumField(); i++ {
+		name, _ := yamlTag(ot.Field(i))
+		if _, ok := structFieldByYamlName(reflect.TypeOf(CollectionParameters{}), name); !ok {
+			t.Errorf("override %s is not a collection parameter", name)
+		}
+	}
+}
+
+func TestDiffZeroOverride(t *testing.T) {
+	a := &Parameters{Clusters: []*ClusterFilterParameters{{Name: "c0", Collection: &CollectionOverrides{}}}}
+	b := &Parameters{Clusters: []*ClusterFilterParameters{{Name: "c0", Collection: &CollectionOverrides{Offset: ptr(uint64(0))}}}}
+	changes := Diff(a, b)
+	want := []Change{{Path: "clusters[c0].collection.offset", Kind: ChangeAdded, New: "0"}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("got %v, want %v", changes, want)
+	}
+}
+
+func TestCollectionForCopies(t *testing.T) {
+	yamlDoc := baseYaml + `    collection:
+      offset: 1
+  - name: c1
+collection:
+  node_group_list: [label_a]
+  include:
+    node: true
+  limits:
+    soft:
+      max_queries: 100
+  schedule:
+    cron: "@hourly"
+`
+	p, err := loadDir(t, map[string]string{"config.yaml": yamlDoc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a cluster with overrides (whose effective parameters are kept), one without and an unknown one
+	for _, name := range []string{"c0", "c1", "unknown"} {
+		for i := 0; i < 2; i++ {
+			cp := p.CollectionFor(name)
+			if cp == p.Collection || cp.Include["pod"] || cp.NodeGroupList[0] != "label_a" || *cp.Limits.Soft.MaxQueries != 100 || cp.Schedule.Jitter != 0 {
+				t.Fatalf("%s: call %d got shared parameters", name, i)
+			}
+			cp.Include["pod"] = true
+			cp.NodeGroupList[0] = "label_x"
+			*cp.Limits.Soft.MaxQueries = 1
+			cp.Schedule.Jitter = time.Minute
+		}
+	}
+	if p.Collection.Include["pod"] || p.Collection.NodeGroupList[0] != "label_a" || *p.Collection.Limits.Soft.MaxQueries != 100 || p.Collection.Schedule.Jitter != 0 {
+		t.Error("the global collection parameters were modified")
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		in   string
+		want map[string]string
+	}{
+		{in: "env=prod, cost_center=42", want: map[string]string{"env": "prod", "cost_center": "42"}},
+		{in: " owner = team a ,", want: map[string]string{"owner": "team a"}},
+		{in: "url=http://x?a=b", want: map[string]string{"url": "http://x?a=b"}},
+		// validate reports a key without value
+		{in: "env", want: map[string]string{"env": Empty}},
+		{in: " , "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := parseTags(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClusterMetadataValidate(t *testing.T) {
+	manyTags := make(map[string]string)
+	for i := 0; i <= maxTags; i++ {
+		manyTags[fmt.Sprintf("t%d", i)] = "v"
+	}
+	tests := []struct {
+		name string
+		cfp  ClusterFilterParameters
+		err  string
+	}{
+		{name: "valid", cfp: ClusterFilterParameters{DisplayName: "Prod", Description: "d", Tags: map[string]string{"env": "prod", "Cost.Center-1_a": "42"}}},
+		{name: "longest", cfp: ClusterFilterParameters{DisplayName: strings.Repeat("x", maxDisplayNameLength), Description: strings.Repeat("x", maxDescriptionLength),
+			Tags: map[string]string{"k" + strings.Repeat("x", maxTagKeyLength-1): strings.Repeat("x", maxTagValueLength)}}},
+		{name: "display name", cfp: ClusterFilterParameters{DisplayName: strings.Repeat("x", maxDisplayNameLength+1)}, err: "display_name is longer than 256"},
+		{name: "description", cfp: ClusterFilterParameters{Description: strings.Repeat("x", maxDescriptionLength+1)}, err: "description is longer than 1024"},
+		{name: "too many tags", cfp: ClusterFilterParameters{Tags: manyTags}, err: "51 tags exceed 50"},
+		{name: "key starting with a digit", cfp: ClusterFilterParameters{Tags: map[string]string{"1env": "prod"}}, err: `invalid tag key "1env"`},
+		{name: "key with a space", cfp: ClusterFilterParameters{Tags: map[string]string{"cost center": "42"}}, err: "invalid tag key"},
+		{name: "empty key", cfp: ClusterFilterParameters{Tags: map[string]string{"": "42"}}, err: "invalid tag key"},
+		{name: "long key", cfp: ClusterFilterParameters{Tags: map[string]string{"k" + strings.Repeat("x", maxTagKeyLength): "v"}}, err: "invalid tag key"},
+		{name: "no value", cfp: ClusterFilterParameters{Tags: map[string]string{"env": ""}}, err: "tag env has no value"},
+		{name: "long value", cfp: ClusterFilterParameters{Tags: map[string]string{"env": strings.Repeat("x", maxTagValueLength+1)}}, err: "value of tag env is longer than 256"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfp.validate()
+			if tt.err == Empty && err != nil || tt.err != Empty && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestClusterMetadataKeys(t *testing.T) {
+	const metadata = "cluster_name=prod\ncluster_display_name=Production\ncluster_description=The prod cluster\ncluster_tags=owner=team-a, env=prod\n"
+	p, err := loadDir(t, map[string]string{"config.properties": baseProperties + metadata})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Clusters) != 1 {
+		t.Fatalf("got %d clusters", len(p.Clusters))
+	}
+	c := p.Clusters[0]
+	want := []Tag{{Key: "env", Value: "prod"}, {Key: "owner", Value: "team-a"}}
+	if c.Name != "prod" || c.DisplayName != "Production" || c.Description != "The prod cluster" || !reflect.DeepEqual(c.TagList(), want) {
+		t.Errorf("got cluster %+v", c)
+	}
+	// invalid tags, positioned at the cluster in the yaml config
+	_, err = loadDir(t, map[string]string{"config.yaml": baseYaml + "  - name: c1\n    tags:\n      1env: prod\n"})
+	if got := positions(err); !reflect.DeepEqual(got, []string{"config.yaml:12"}) {
+		t.Errorf("got error %v at %v", err, got)
+	}
+	// environment variables over the file
+	t.Setenv("CLUSTER_TAGS", "env=staging")
+	if p, err = loadDir(t, map[string]string{"config.properties": baseProperties + metadata}); err != nil {
+		t.Fatal(err)
+	}
+	if tags := p.Clusters[0].Tags; !reflect.DeepEqual(tags, map[string]string{"env": "staging"}) {
+		t.Errorf("got tags %v", tags)
+	}
+	t.Setenv("CLUSTER_TAGS", "env")
+	if _, err = loadDir(t, map[string]string{"config.properties": baseProperties + metadata}); err == nil || !strings.Contains(err.Error(), "cluster prod: tag env has no value") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestDuplicateClusterNames(t *testing.T) {
+	_, err := loadDir(t, map[string]string{"config.yaml": baseYaml + "  - name: c1\n  - name: c0\n"})
+	if err == nil || !strings.Contains(err.Error(), "cluster c0: duplicate cluster name") {
+		t.Fatalf("got error %v", err)
+	}
+	if got := positions(err); !reflect.DeepEqual(got, []string{"config.yaml:13"}) {
+		t.Errorf("got error %v at %v", err, got)
+	}
+}
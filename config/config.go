@@ -2,8 +2,10 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
 	"strconv"
 	"strings"
+	"time"
 
 	ncommon "github.com/densify-dev/net-utils/common"
 	"github.com/densify-dev/net-utils/rhttp"
@@ -20,12 +22,24 @@ const (
 type ClusterFilterParameters struct {
 	Name        string         `yaml:"name"`
 	Identifiers model.LabelSet `yaml:"identifiers,omitempty"`
+	// DisplayName, Description and Tags are business metadata (e.g. cost center, environment, owner)
+	// forwarded with the collected data, see TagList for their serialization order
+	DisplayName string            `yaml:"display_name,omitempty"`
+	Description string            `yaml:"description,omitempty"`
+	Tags        map[string]string `yaml:"tags,omitempty"`
+	// Collection overrides the global collection parameters for this cluster, see Parameters.CollectionFor
+	Collection *CollectionOverrides `yaml:"collection,omitempty"`
+	// collection holds the effective collection parameters of this cluster, set at finalize time
+	collection *CollectionParameters
 }
 
 type DensifyParameters struct {
 	UrlConfig   *UrlConfig         `yaml:"url"`
 	Endpoint    string             `yaml:"endpoint"`
+	Auth        *DensifyAuth       `yaml:"auth,omitempty"`
 	RetryConfig *rhttp.RetryConfig `yaml:"retry,omitempty"`
+	// implicitAuth indicates Auth was derived from the url credentials at finalize time
+	implicitAuth bool
 }
 
 type ProxyParameters struct {
@@ -36,9 +50,18 @@ type ProxyParameters struct {
 }
 
 type ForwarderParameters struct {
+	// Densify is the Densify instance the output is sent to; with Destinations, it is set at finalize time
+	// to the first densify destination (nil if there is none)
 	Densify *DensifyParameters `yaml:"densify"`
 	Proxy   *ProxyParameters   `yaml:"proxy,omitempty"`
-	Prefix  string             `yaml:"prefix,omitempty"`
+	// Prefix is the zip file prefix, with placeholders (see PrefixContext) rendered by RenderPrefix
+	Prefix string `yaml:"prefix,omitempty"`
+	// Destinations lists where the output is sent; if omitted, Densify is the single destination
+	Destinations []*Destination `yaml:"destinations,omitempty"`
+	// implicitDestinations indicates Destinations was derived from Densify at finalize time
+	implicitDestinations bool
+	// explicitDensify indicates Densify was given rather than filled with the defaults
+	explicitDensify bool
 }
 
 type PrometheusParameters struct {
@@ -47,20 +70,51 @@ type PrometheusParameters struct {
 	CaCertPath  string             `yaml:"ca_cert,omitempty"`
 	SigV4Config *sigv4.SigV4Config `yaml:"sigv4,omitempty"`
 	RetryConfig *rhttp.RetryConfig `yaml:"retry,omitempty"`
+	// Flavor is the backend of the Prometheus API (e.g. thanos, mimir or amp); if omitted it is inferred
+	// from the host of a managed service, or set by DetectFlavor - which FlavorDetect runs when loading
+	Flavor string `yaml:"flavor,omitempty"`
 }
 
 type CollectionParameters struct {
-	Include       map[string]bool `yaml:"include,omitempty"`
-	Interval      string          `yaml:"interval"`
-	IntervalSize  uint64          `yaml:"interval_size"`
-	History       uint64          `yaml:"history"`
-	HistoryInt    int             `yaml:"-"`
-	Offset        uint64          `yaml:"offset"`
-	OffsetInt     int             `yaml:"-"`
-	SampleRate    uint64          `yaml:"sample_rate"`
-	SampleRateSt  string          `yaml:"-"`
-	NodeGroupList string          `yaml:"node_group_list"`
-	RoleList      string          `yaml:"role_list"`
+	Include      map[string]bool `yaml:"include,omitempty"`
+	Interval     string          `yaml:"interval"`
+	IntervalSize uint64          `yaml:"interval_size"`
+	History      uint64          `yaml:"history"`
+	HistoryInt   int             `yaml:"-"`
+	Offset       uint64          `yaml:"offset"`
+	OffsetInt    int             `yaml:"-"`
+	// SampleRate is the resolution of the queries, a duration (e.g. 30s, 5m) or a number of minutes
+	SampleRate SampleRate `yaml:"sample_rate"`
+	// Deprecated: SampleRateSt is the number of minutes of SampleRate, rounded up if it is not a whole number
+	// of minutes - use SampleRate.Step() instead
+	SampleRateSt string `yaml:"-"`
+	// NodeGroupList holds the names of the node labels checked for building node groups, in priority
+	// order - a node belongs to the node group of the first label it has. The list replaces the default one,
+	// whereas NodeGroupListExtra is appended to it (or to the default one) at finalize time
+	NodeGroupList      StringList `yaml:"node_group_list"`
+	NodeGroupListExtra StringList `yaml:"node_group_list_extra,omitempty"`
+	// RoleList holds the node role names checked for building node groups, in priority order
+	RoleList StringList          `yaml:"role_list"`
+	Limits   *CollectionLimits   `yaml:"limits,omitempty"`
+	Schedule *ScheduleParameters `yaml:"schedule,omitempty"`
+}
+
+// CollectionOverrides overrides the collection parameters of the same name for a cluster: a field set
+// (including to its zero value, e.g. offset: 0) replaces the global one, a field not set (nil) keeps it.
+// The include map, the lists, the limits and the schedule replace the global ones rather than being merged
+// with them
+type CollectionOverrides struct {
+	Include            map[string]bool     `yaml:"include,omitempty"`
+	Interval           *string             `yaml:"interval,omitempty"`
+	IntervalSize       *uint64             `yaml:"interval_size,omitempty"`
+	History            *uint64             `yaml:"history,omitempty"`
+	Offset             *uint64             `yaml:"offset,omitempty"`
+	SampleRate         *SampleRate         `yaml:"sample_rate,omitempty"`
+	NodeGroupList      *StringList         `yaml:"node_group_list,omitempty"`
+	NodeGroupListExtra *StringList         `yaml:"node_group_list_extra,omitempty"`
+	RoleList           *StringList         `yaml:"role_list,omitempty"`
+	Limits             *CollectionLimits   `yaml:"limits,omitempty"`
+	Schedule           *ScheduleParameters `yaml:"schedule,omitempty"`
 }
 
 type Parameters struct {
@@ -72,6 +126,8 @@ type Parameters struct {
 }
 
 func merge(p *Parameters, pm *parameterMap) (newP *Parameters, err error) {
+	// the densify section is given if it is in the config, by a densify key or by an override
+	explicitDensify := p != nil && p.Forwarder != nil && p.Forwarder.Densify != nil || pm.anySet(densifyKeys...)
 	if p == nil {
 		pm.finalize()
 		includes, _ := getIncludes(pm)
@@ -81,6 +137,7 @@ func merge(p *Parameters, pm *parameterMap) (newP *Parameters, err error) {
 				Densify: &DensifyParameters{
 					UrlConfig: getUrlConfig(pm, []string{densifyScheme, densifyHost, densifyPort, densifyUser, densifyPassword, densifyEncPassword}),
 					Endpoint:  pm.stringValues[densifyEndpoint].v,
+					Auth:      getDensifyAuth(pm),
 				},
 				Proxy: &ProxyParameters{
 					UrlConfig: getUrlConfig(pm, []string{proxyScheme, proxyHost, proxyPort, proxyUser, proxyPassword, proxyEncPassword}),
@@ -94,75 +151,89 @@ func merge(p *Parameters, pm *parameterMap) (newP *Parameters, err error) {
 				UrlConfig:   getUrlConfig(pm, []string{promScheme, promHost, promPort, promUser, promPassword, promPassword}),
 				BearerToken: pm.stringValues[promToken].v,
 				CaCertPath:  pm.stringValues[caCert].v,
+				Flavor:      pm.stringValues[promFlavor].v,
 			},
 			Collection: &CollectionParameters{
-				Include:       includes,
-				Interval:      pm.stringValues[interval].v,
-				IntervalSize:  pm.uint64Values[intervalSize].v,
-				History:       pm.uint64Values[history].v,
-				Offset:        pm.uint64Values[offset].v,
-				SampleRate:    pm.uint64Values[sampleRate].v,
-				NodeGroupList: pm.stringValues[nodeGroupList].v,
-				RoleList:      pm.stringValues[roleList].v,
+				Include:            includes,
+				Interval:           pm.stringValues[interval].v,
+				IntervalSize:       pm.uint64Values[intervalSize].v,
+				History:            pm.uint64Values[history].v,
+				Offset:             pm.uint64Values[offset].v,
+				SampleRate:         pm.rateValues[sampleRate].v,
+				NodeGroupList:      NewStringList(pm.stringValues[nodeGroupList].v),
+				NodeGroupListExtra: NewStringList(pm.stringValues[nodeGroupListExtra].v),
+				RoleList:           NewStringList(pm.stringValues[roleList].v),
 			},
 			Clusters: []*ClusterFilterParameters{cfp},
 			Debug:    pm.boolValues[debug].v,
 		}
 	} else {
-		if pm.fromFile {
-			err = fmt.Errorf("yaml configuration and properties configuration are mutually exclusive")
-			return
-		} else {
-			newP = p
-			newP.ensureStructs()
-			// forwarder parameters:
-			// 		densify parameters
-			setValue(&newP.Forwarder.Densify.UrlConfig.Scheme, pm.stringValues, densifyScheme)
-			setValue(&newP.Forwarder.Densify.UrlConfig.Host, pm.stringValues, densifyHost)
-			setValue(&newP.Forwarder.Densify.UrlConfig.Port, pm.uint64Values, densifyPort)
-			setValue(&newP.Forwarder.Densify.UrlConfig.Username, pm.stringValues, densifyUser)
-			setValue(&newP.Forwarder.Densify.UrlConfig.Password, pm.stringValues, densifyPassword)
-			setValue(&newP.Forwarder.Densify.UrlConfig.EncryptedPassword, pm.stringValues, densifyEncPassword)
-			setValue(&newP.Forwarder.Densify.Endpoint, pm.stringValues, densifyEndpoint)
-			// 		proxy parameters
-			setValue(&newP.Forwarder.Proxy.UrlConfig.Scheme, pm.stringValues, proxyScheme)
-			setValue(&newP.Forwarder.Proxy.UrlConfig.Host, pm.stringValues, proxyHost)
-			setValue(&newP.Forwarder.Proxy.UrlConfig.Port, pm.uint64Values, proxyPort)
-			setValue(&newP.Forwarder.Proxy.UrlConfig.Username, pm.stringValues, proxyUser)
-			setValue(&newP.Forwarder.Proxy.UrlConfig.Password, pm.stringValues, proxyPassword)
-			setValue(&newP.Forwarder.Proxy.UrlConfig.EncryptedPassword, pm.stringValues, proxyEncPassword)
-			setValue(&newP.Forwarder.Proxy.Auth, pm.stringValues, proxyAuth)
-			setValue(&newP.Forwarder.Proxy.Server, pm.stringValues, proxyServer)
-			setValue(&newP.Forwarder.Proxy.Domain, pm.stringValues, proxyDomain)
-			// 		prefix parameters
-			setValue(&newP.Forwarder.Prefix, pm.stringValues, filePrefix)
-			// prometheus parameters
-			setValue(&newP.Prometheus.UrlConfig.Scheme, pm.stringValues, promScheme)
-			setValue(&newP.Prometheus.UrlConfig.Host, pm.stringValues, promHost)
-			setValue(&newP.Prometheus.UrlConfig.Port, pm.uint64Values, promPort)
-			setValue(&newP.Prometheus.UrlConfig.Username, pm.stringValues, promUser)
-			setValue(&newP.Prometheus.UrlConfig.Password, pm.stringValues, promPassword)
-			setValue(&newP.Prometheus.BearerToken, pm.stringValues, promToken)
-			setValue(&newP.Prometheus.CaCertPath, pm.stringValues, caCert)
-			// collection parameters
-			if includes, set := getIncludes(pm); set {
-				newP.Collection.Include = includes
+		if pm.mixed {
+			for _, key := range pm.fileKeys() {
+				slog.Warn("deprecated properties key overrides the yaml configuration", "key", key)
 			}
-			setValue(&newP.Collection.Interval, pm.stringValues, interval)
-			setValue(&newP.Collection.IntervalSize, pm.uint64Values, intervalSize)
-			setValue(&newP.Collection.History, pm.uint64Values, history)
-			setValue(&newP.Collection.Offset, pm.uint64Values, offset)
-			setValue(&newP.Collection.SampleRate, pm.uint64Values, sampleRate)
-			setValue(&newP.Collection.NodeGroupList, pm.stringValues, nodeGroupList)
-			setValue(&newP.Collection.RoleList, pm.stringValues, roleList)
-			// cluster parameter
-			if cfp, set := getClusterFilterParameters(pm); set {
-				newP.Clusters = append(newP.Clusters, cfp)
+		}
+		newP = p
+		newP.ensureStructs()
+		// forwarder parameters:
+		// 		densify parameters
+		setValue(&newP.Forwarder.Densify.UrlConfig.Scheme, pm.stringValues, densifyScheme)
+		setValue(&newP.Forwarder.Densify.UrlConfig.Host, pm.stringValues, densifyHost)
+		setValue(&newP.Forwarder.Densify.UrlConfig.Port, pm.portValues, densifyPort)
+		setValue(&newP.Forwarder.Densify.UrlConfig.Username, pm.stringValues, densifyUser)
+		setValue(&newP.Forwarder.Densify.UrlConfig.Password, pm.stringValues, densifyPassword)
+		setValue(&newP.Forwarder.Densify.UrlConfig.EncryptedPassword, pm.stringValues, densifyEncPassword)
+		setValue(&newP.Forwarder.Densify.Endpoint, pm.stringValues, densifyEndpoint)
+		if auth := getDensifyAuth(pm); auth != nil {
+			newP.Forwarder.Densify.Auth = auth
+		}
+		// 		proxy parameters
+		setValue(&newP.Forwarder.Proxy.UrlConfig.Scheme, pm.stringValues, proxyScheme)
+		setValue(&newP.Forwarder.Proxy.UrlConfig.Host, pm.stringValues, proxyHost)
+		setValue(&newP.Forwarder.Proxy.UrlConfig.Port, pm.portValues, proxyPort)
+		setValue(&newP.Forwarder.Proxy.UrlConfig.Username, pm.stringValues, proxyUser)
+		setValue(&newP.Forwarder.Proxy.UrlConfig.Password, pm.stringValues, proxyPassword)
+		setValue(&newP.Forwarder.Proxy.UrlConfig.EncryptedPassword, pm.stringValues, proxyEncPassword)
+		setValue(&newP.Forwarder.Proxy.Auth, pm.stringValues, proxyAuth)
+		setValue(&newP.Forwarder.Proxy.Server, pm.stringValues, proxyServer)
+		setValue(&newP.Forwarder.Proxy.Domain, pm.stringValues, proxyDomain)
+		// 		prefix parameters
+		setValue(&newP.Forwarder.Prefix, pm.stringValues, filePrefix)
+		// prometheus parameters
+		setValue(&newP.Prometheus.UrlConfig.Scheme, pm.stringValues, promScheme)
+		setValue(&newP.Prometheus.UrlConfig.Host, pm.stringValues, promHost)
+		setValue(&newP.Prometheus.UrlConfig.Port, pm.portValues, promPort)
+		setValue(&newP.Prometheus.UrlConfig.Username, pm.stringValues, promUser)
+		setValue(&newP.Prometheus.UrlConfig.Password, pm.stringValues, promPassword)
+		setValue(&newP.Prometheus.BearerToken, pm.stringValues, promToken)
+		setValue(&newP.Prometheus.CaCertPath, pm.stringValues, caCert)
+		setValue(&newP.Prometheus.Flavor, pm.stringValues, promFlavor)
+		// collection parameters
+		if includes, set := getIncludes(pm); set {
+			newP.Collection.Include = includes
+		}
+		setValue(&newP.Collection.Interval, pm.stringValues, interval)
+		setValue(&newP.Collection.IntervalSize, pm.uint64Values, intervalSize)
+		setValue(&newP.Collection.History, pm.uint64Values, history)
+		setValue(&newP.Collection.Offset, pm.uint64Values, offset)
+		setValue(&newP.Collection.SampleRate, pm.rateValues, sampleRate)
+		setListValue(&newP.Collection.NodeGroupList, pm.stringValues, nodeGroupList)
+		setListValue(&newP.Collection.NodeGroupListExtra, pm.stringValues, nodeGroupListExtra)
+		setListValue(&newP.Collection.RoleList, pm.stringValues, roleList)
+		// cluster parameter
+		if cfp, set := getClusterFilterParameters(pm); set {
+			if err = newP.setCluster(cfp); err != nil {
+				return
 			}
-			// debug parameter
-			setValue(&newP.Debug, pm.boolValues, debug)
 		}
+		// debug parameter
+		setValue(&newP.Debug, pm.boolValues, debug)
 	}
+	if err = newP.applyOverrides(pm.overrides); err != nil {
+		return
+	}
+	newP.applySecret(pm.secret)
+	newP.Forwarder.explicitDensify = explicitDensify || hasOverride(pm.overrides, "forwarder", "densify")
 	err = newP.finalize()
 	return
 }
@@ -199,23 +270,37 @@ func (p *Parameters) ensureStructs() {
 func setValue[T comparable](target *T, vals values[T], name string) {
 	if val, ok := vals[name]; ok {
 		var zeroValue T
-		if val.isSet || *target == zeroValue {
+		if takesPrecedence(val.isSet, *target == zeroValue) {
 			*target = val.v
 		}
 	}
 }
 
+// takesPrecedence is the precedence rule of layered values (see setValue and mergeNodes): a value replaces
+// the current one if it is set explicitly, or if the current one is the zero value
+func takesPrecedence(isSet, currentZero bool) bool {
+	return isSet || currentZero
+}
+
 func getUrlConfig(pm *parameterMap, paramNames []string) *UrlConfig {
 	return &UrlConfig{
 		Scheme:            pm.stringValues[paramNames[0]].v,
 		Host:              pm.stringValues[paramNames[1]].v,
-		Port:              pm.uint64Values[paramNames[2]].v,
+		Port:              pm.portValues[paramNames[2]].v,
 		Username:          pm.stringValues[paramNames[3]].v,
 		Password:          pm.stringValues[paramNames[4]].v,
 		EncryptedPassword: pm.stringValues[paramNames[5]].v,
 	}
 }
 
+// getDensifyAuth returns the token auth if the densify token is set, nil otherwise
+func getDensifyAuth(pm *parameterMap) *DensifyAuth {
+	if val, ok := pm.stringValues[densifyToken]; ok && val.v != Empty {
+		return &DensifyAuth{Type: AuthToken, Token: &TokenAuth{Token: val.v}}
+	}
+	return nil
+}
+
 func getIncludes(pm *parameterMap) (m map[string]bool, set bool) {
 	if val, ok := pm.stringValues[include]; ok {
 		set = val.isSet
@@ -230,28 +315,101 @@ func getIncludes(pm *parameterMap) (m map[string]bool, set bool) {
 
 func getClusterFilterParameters(pm *parameterMap) (cfp *ClusterFilterParameters, set bool) {
 	if val, ok := pm.stringValues[clusterName]; ok {
-		set = val.isSet
-		cfp = &ClusterFilterParameters{Name: val.v}
+		for _, key := range []string{clusterName, clusterDisplayName, clusterDescription, clusterTags} {
+			set = set || pm.stringValues[key].isSet
+		}
+		cfp = &ClusterFilterParameters{
+			Name:        val.v,
+			DisplayName: pm.stringValues[clusterDisplayName].v,
+			Description: pm.stringValues[clusterDescription].v,
+			Tags:        parseTags(pm.stringValues[clusterTags].v),
+		}
 	}
 	return
 }
 
+// finalize validates and completes the parameters; its errors are field errors, which are positioned in the
+// config document if the field is in it
 func (p *Parameters) finalize() (err error) {
-	p.Collection.HistoryInt = int(p.Collection.History)
-	p.Collection.OffsetInt = int(p.Collection.Offset)
-	p.Collection.SampleRateSt = strconv.FormatUint(p.Collection.SampleRate, 10)
-	if err = p.Forwarder.Densify.UrlConfig.finalize(); err != nil {
+	var warnings []string
+	if warnings, err = p.Collection.finalize(); err != nil {
+		return atField(err, "collection")
+	}
+	for _, w := range warnings {
+		slog.Warn("collection window exceeds soft limit", "limit", w)
+	}
+	if err = p.validateClusters(); err != nil {
 		return
 	}
-	if err = p.Forwarder.Densify.RetryConfig.Validate(); err != nil {
+	if err = p.finalizeClusterCollections(warnings); err != nil {
 		return
 	}
+	// Prometheus over plain http listens by default on 9090 rather than on the scheme's default port
+	if uc := p.Prometheus.UrlConfig; uc.Port.IsAuto() && strings.EqualFold(uc.Scheme, Http) {
+		uc.Port = NewPort(defPromHttpPort)
+	}
+	if err = p.Forwarder.finalizeDestinations(); err != nil {
+		return atField(err, "forwarder", "destinations")
+	}
+	// the densify destinations are finalized as such, only the densify section is left
+	if p.Forwarder.implicitDestinations {
+		if err = p.Forwarder.Densify.UrlConfig.finalize(); err != nil {
+			return atField(err, "forwarder", "densify", "url")
+		}
+		if p.Forwarder.Densify.UrlConfig.Url != Empty {
+			if _, err = p.Forwarder.Densify.EndpointURL(); err != nil {
+				return atField(err, "forwarder", "densify", "endpoint")
+			}
+		}
+		if err = p.Forwarder.Densify.finalizeAuth(); err != nil {
+			return atField(err, "forwarder", "densify", "auth")
+		}
+		if err = p.Forwarder.Densify.RetryConfig.Validate(); err != nil {
+			return atField(err, "forwarder", "densify", "retry")
+		}
+	}
+	if err = p.Forwarder.validatePrefix(); err != nil {
+		return atField(err, "forwarder", "prefix")
+	}
 	if err = p.Forwarder.Proxy.UrlConfig.finalize(); err != nil {
-		return
+		return atField(err, "forwarder", "proxy", "url")
 	}
 	if err = p.Prometheus.UrlConfig.finalize(); err != nil {
-		return
+		return atField(err, "prometheus", "url")
+	}
+	if err = p.Prometheus.finalizeFlavor(); err != nil {
+		return atField(err, "prometheus", "flavor")
+	}
+	return atField(p.Prometheus.RetryConfig.Validate(), "prometheus", "retry")
+}
+
+// finalize validates the collection parameters, and returns the soft limits exceeded by the collection window
+func (cp *CollectionParameters) finalize() (warnings []string, err error) {
+	cp.HistoryInt = int(cp.History)
+	cp.OffsetInt = int(cp.Offset)
+	// rounding up keeps SampleRateSt a valid PromQL step (in minutes) for a sub-minute sample rate
+	n, ok := cp.SampleRate.Minutes()
+	if !ok && cp.SampleRate > 0 {
+		n = uint64((cp.SampleRate.Duration() + time.Minute - 1) / time.Minute)
+	}
+	cp.SampleRateSt = strconv.FormatUint(n, 10)
+	if err = cp.finalizeNodeGroupList(); err == nil {
+		warnings, err = cp.validateWindow()
 	}
-	err = p.Prometheus.RetryConfig.Validate()
 	return
 }
+
+func (cp *CollectionParameters) finalizeNodeGroupList() error {
+	cp.NodeGroupList = cp.NodeGroupList.appendUnique(cp.NodeGroupListExtra)
+	cp.NodeGroupListExtra = nil
+	var invalid []string
+	for _, name := range cp.NodeGroupList {
+		if !model.LabelName(name).IsValidLegacy() {
+			invalid = append(invalid, name)
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("invalid label names in %s: %s", nodeGroupList, strings.Join(invalid, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package config
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	baseProperties = "prometheus_address=prom\nproxyprotocol=http\nproxyhost=proxy\n"
+	baseYaml       = `
+prometheus:
+  url:
+    host: prom
+forwarder:
+  proxy:
+    url:
+      scheme: http
+      host: proxy
+clusters:
+  - name: c0
+`
+)
+
+// metaKeys are the keys of the config files themselves, which are not merged into Parameters
+var metaKeys = map[string]bool{
+	config:           true,
+	configDir:        true,
+	configFile:       true,
+	configType:       true,
+	configOverlay:    true,
+	profile:          true,
+	configNoExpand:   true,
+	allowMixedConfig: true,
+	configStrict:     true,
+	configUrl:        true,
+	configUrlCache:   true,
+	configUrlSha256:  true,
+	configUrlHmacKey: true,
+}
+
+func lastCluster(p *Parameters) *ClusterFilterParameters {
+	return p.Clusters[len(p.Clusters)-1]
+}
+
+// keyTests set each key to value, get returns the resulting field
+var keyTests = []struct {
+	key   string
+	value string
+	get   func(*Parameters) any
+	want  any
+}{
+	{debug, "true", func(p *Parameters) any { return p.Debug }, true},
+	{clusterName, "c1", func(p *Parameters) any { return lastCluster(p).Name }, "c1"},
+	{clusterDisplayName, "Cluster 1", func(p *Parameters) any { return lastCluster(p).DisplayName }, "Cluster 1"},
+	{clusterDescription, "first", func(p *Parameters) any { return lastCluster(p).Description }, "first"},
+	{clusterTags, "env=prod", func(p *Parameters) any { return lastCluster(p).Tags }, map[string]string{"env": "prod"}},
+	{promScheme, Https, func(p *Parameters) any { return p.Prometheus.UrlConfig.Scheme }, Https},
+	{promHost, "prom2", func(p *Parameters) any { return p.Prometheus.UrlConfig.Host }, "prom2"},
+	{promPort, "9091", func(p *Parameters) any { return p.Prometheus.UrlConfig.Port }, NewPort(9091)},
+	{promUser, "pu", func(p *Parameters) any { return p.Prometheus.UrlConfig.Username }, "pu"},
+	{promPassword, "pp", func(p *Parameters) any { return p.Prometheus.UrlConfig.Password }, "pp"},
+	{promToken, "pt", func(p *Parameters) any { return p.Prometheus.BearerToken }, "pt"},
+	{caCert, "/ca.crt", func(p *Parameters) any { return p.Prometheus.CaCertPath }, "/ca.crt"},
+	{promFlavor, FlavorThanos, func(p *Parameters) any { return p.Prometheus.Flavor }, FlavorThanos},
+	{include, "node,cluster", func(p *Parameters) any { return p.Collection.Include }, map[string]bool{"node": true, "cluster": true}},
+	{nodeGroupList, "label_a,label_b", func(p *Parameters) any { return p.Collection.NodeGroupList }, StringList{"label_a", "label_b"}},
+	{nodeGroupListExtra, "label_x", func(p *Parameters) any {
+		return p.Collection.NodeGroupList[len(p.Collection.NodeGroupList)-1]
+	}, "label_x"},
+	{roleList, "worker", func(p *Parameters) any { return p.Collection.RoleList }, StringList{"worker"}},
+	{interval, Days, func(p *Parameters) any { return p.Collection.Interval }, Days},
+	{intervalSize, "2", func(p *Parameters) any { return p.Collection.IntervalSize }, uint64(2)},
+	{sampleRate, "1m", func(p *Parameters) any { return p.Collection.SampleRate }, SampleRate(time.Minute)},
+	{history, "3", func(p *Parameters) any { return p.Collection.History }, uint64(3)},
+	{offset, "1", func(p *Parameters) any { return p.Collection.Offset }, uint64(1)},
+	{densifyScheme, Http, func(p *Parameters) any { return p.Forwarder.Densify.UrlConfig.Scheme }, Http},
+	{densifyHost, "densify", func(p *Parameters) any { return p.Forwarder.Densify.UrlConfig.Host }, "densify"},
+	{densifyPort, "8443", func(p *Parameters) any { return p.Forwarder.Densify.UrlConfig.Port }, NewPort(8443)},
+	{densifyEndpoint, "/api/v3/", func(p *Parameters) any { return p.Forwarder.Densify.Endpoint }, "/api/v3/"},
+	{densifyUser, "du", func(p *Parameters) any { return p.Forwarder.Densify.UrlConfig.Username }, "du"},
+	{densifyPassword, "dp", func(p *Parameters) any { return p.Forwarder.Densify.UrlConfig.Password }, "dp"},
+	{densifyEncPassword, "de", func(p *Parameters) any { return p.Forwarder.Densify.UrlConfig.EncryptedPassword }, "de"},
+	{densifyToken, "dt", func(p *Parameters) any { return p.Forwarder.Densify.Auth.Token.Token }, "dt"},
+	{proxyScheme, Https, func(p *Parameters) any { return p.Forwarder.Proxy.UrlConfig.Scheme }, Https},
+	{proxyHost, "proxy2", func(p *Parameters) any { return p.Forwarder.Proxy.UrlConfig.Host }, "proxy2"},
+	{proxyPort, "3128", func(p *Parameters) any { return p.Forwarder.Proxy.UrlConfig.Port }, NewPort(3128)},
+	{proxyAuth, "NTLM", func(p *Parameters) any { return p.Forwarder.Proxy.Auth }, "NTLM"},
+	{proxyServer, "srv", func(p *Parameters) any { return p.Forwarder.Proxy.Server }, "srv"},
+	{proxyDomain, "dom", func(p *Parameters) any { return p.Forwarder.Proxy.Domain }, "dom"},
+	{proxyUser, "xu", func(p *Parameters) any { return p.Forwarder.Proxy.UrlConfig.Username }, "xu"},
+	{proxyPassword, "xp", func(p *Parameters) any { return p.Forwarder.Proxy.UrlConfig.Password }, "xp"},
+	{proxyEncPassword, "xe", func(p *Parameters) any { return p.Forwarder.Proxy.UrlConfig.EncryptedPassword }, "xe"},
+	{filePrefix, "pre", func(p *Parameters) any { return p.Forwarder.Prefix }, "pre"},
+}
+
+// loadDir writes files to a temporary config directory and loads the config from it with args
+func loadDir(t *testing.T, files map[string]string, args ...string) (*Parameters, error) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs := pflag.NewFlagSet(t.Name(), pflag.ContinueOnError)
+	return load(fs, &options{args: append([]string{"--" + configDir, dir}, args...)})
+}
+
+// captureLogs returns the buffer the default logger writes to until the test ends
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func TestMergeKeys(t *testing.T) {
+	modes := []struct {
+		name  string
+		files func(key, value string) map[string]string
+		args  func(key, value string) []string
+		warns bool
+	}{
+		{
+			name: "properties",
+			files: func(key, value string) map[string]string {
+				return map[string]string{"config.properties": baseProperties + key + "=" + value + "\n"}
+			},
+			args: func(string, string) []string { return nil },
+		},
+		{
+			name: "yaml",
+			files: func(string, string) map[string]string {
+				return map[string]string{"config.yaml": baseYaml}
+			},
+			args: func(key, value string) []string { return []string{"--" + key + "=" + value} },
+		},
+		{
+			name: "mixed",
+			files: func(key, value string) map[string]string {
+				return map[string]string{"config.yaml": baseYaml, "config.properties": key + "=" + value + "\n"}
+			},
+			args:  func(string, string) []string { return []string{"--" + allowMixedConfig} },
+			warns: true,
+		},
+	}
+	for _, mode := range modes {
+		for _, tt := range keyTests {
+			t.Run(mode.name+"/"+tt.key, func(t *testing.T) {
+				logs := captureLogs(t)
+				p, err := loadDir(t, mode.files(tt.key, tt.value), mode.args(tt.key, tt.value)...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := tt.get(p); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+				if warned := strings.Contains(logs.String(), "key="+tt.key+"\n"); warned != mode.warns {
+					t.Errorf("deprecation warning logged: %t, want %t", warned, mode.warns)
+				}
+			})
+		}
+	}
+}
+
+func TestMergeKeysCovered(t *testing.T) {
+	tested := make(map[string]bool, len(keyTests))
+	for _, tt := range keyTests {
+		tested[tt.key] = true
+	}
+	for key := range initParameterMap().keys {
+		if !metaKeys[key] && !tested[key] {
+			t.Errorf("key %s is not tested", key)
+		}
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		val     *value[string]
+		want    string
+	}{
+		{name: "set replaces", current: "yaml", val: &value[string]{v: "flag", isSet: true}, want: "flag"},
+		{name: "default keeps", current: "yaml", val: &value[string]{v: "default"}, want: "yaml"},
+		{name: "default fills zero", current: Empty, val: &value[string]{v: "default"}, want: "default"},
+		{name: "set empty replaces", current: "yaml", val: &value[string]{v: Empty, isSet: true}, want: Empty},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := tt.current
+			setValue(&target, values[string]{interval: tt.val}, interval)
+			if target != tt.want {
+				t.Errorf("got %q, want %q", target, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergePrecedence(t *testing.T) {
+	yamlDoc := baseYaml + "collection:\n  interval_size: 3\n  history: 4\n"
+	files := map[string]string{"config.yaml": yamlDoc, "config.properties": "history=5\noffset=2\n"}
+	p, err := loadDir(t, files, "--"+allowMixedConfig, "--"+offset+"=6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := p.Collection
+	// yaml over default, properties over yaml, flag over properties
+	if c.IntervalSize != 3 || c.History != 5 || c.Offset != 6 {
+		t.Errorf("got interval_size %d, history %d, offset %d, want 3, 5, 6", c.IntervalSize, c.History, c.Offset)
+	}
+}
+
+func TestSetCluster(t *testing.T) {
+	twoClusters := baseYaml + "  - name: c1\n"
+	tests := []struct {
+		name  string
+		yaml  string
+		args  []string
+		names []string
+		err   bool
+	}{
+		{name: "metadata of the only cluster", yaml: baseYaml, args: []string{"--" + clusterDescription + "=d"}, names: []string{"c0"}},
+		{name: "metadata of the named cluster", yaml: twoClusters, args: []string{"--" + clusterName + "=c1", "--" + clusterDescription + "=d"}, names: []string{"c0", "c1"}},
+		{name: "new cluster", yaml: twoClusters, args: []string{"--" + clusterName + "=c2", "--" + clusterDescription + "=d"}, names: []string{"c0", "c1", "c2"}},
+		{name: "metadata without a name", yaml: twoClusters, args: []string{"--" + clusterDescription + "=d"}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := loadDir(t, map[string]string{"config.yaml": tt.yaml}, tt.args...)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, cfp := range p.Clusters {
+				names = append(names, cfp.Name)
+			}
+			if !reflect.DeepEqual(names, tt.names) || lastCluster(p).Description != "d" {
+				t.Errorf("got clusters %v, description %q", names, lastCluster(p).Description)
+			}
+		})
+	}
+}
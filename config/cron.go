@@ -0,0 +1,181 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed standard 5-field cron expression (minute, hour, day of month, month, day of week)
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domStar / dowStar indicate the day of month / week field is *, as when both are restricted a day
+	// matching either of them matches (as in cron)
+	domStar, dowStar bool
+}
+
+type cronField struct {
+	min, max uint
+}
+
+var (
+	minuteField = cronField{0, 59}
+	hourField   = cronField{0, 23}
+	domField    = cronField{1, 31}
+	monthField  = cronField{1, 12}
+	dowField    = cronField{0, 7}
+)
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+func parseCron(expr string) (cs *cronSchedule, err error) {
+	if macro, f := cronMacros[strings.ToLower(strings.TrimSpace(expr))]; f {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		err = fmt.Errorf("invalid cron expression %q: expected 5 fields", expr)
+		return
+	}
+	cs = &cronSchedule{domStar: fields[2] == "*", dowStar: fields[4] == "*"}
+	for i, spec := range []struct {
+		bits  *uint64
+		field cronField
+	}{{&cs.minute, minuteField}, {&cs.hour, hourField}, {&cs.dom, domField}, {&cs.month, monthField}, {&cs.dow, dowField}} {
+		if *spec.bits, err = spec.field.parse(fields[i]); err != nil {
+			err = fmt.Errorf("invalid cron expression %q: %w", expr, err)
+			cs = nil
+			return
+		}
+	}
+	// 7 is Sunday as well as 0
+	if cs.dow&(1<<7) != 0 {
+		cs.dow |= 1
+	}
+	return
+}
+
+func (cf cronField) parse(s string) (b uint64, err error) {
+	for _, part := range strings.Split(s, Comma) {
+		rng, stepSt, hasStep := strings.Cut(part, Slash)
+		step := uint64(1)
+		if hasStep {
+			if step, err = strconv.ParseUint(stepSt, 10, 8); err != nil || step == 0 {
+				err = fmt.Errorf("invalid step %s", stepSt)
+				return
+			}
+		}
+		lo, hi := cf.min, cf.max
+		if rng != "*" {
+			loSt, hiSt, isRange := strings.Cut(rng, "-")
+			if lo, err = cf.value(loSt); err != nil {
+				return
+			}
+			hi = lo
+			if isRange {
+				if hi, err = cf.value(hiSt); err != nil {
+					return
+				}
+			} else if hasStep {
+				hi = cf.max
+			}
+			if hi < lo {
+				err = fmt.Errorf("invalid range %s", rng)
+				return
+			}
+		}
+		for v := lo; v <= hi; v += uint(step) {
+			b |= 1 << v
+		}
+	}
+	return
+}
+
+func (cf cronField) value(s string) (v uint, err error) {
+	var n uint64
+	if n, err = strconv.ParseUint(s, 10, 8); err != nil || uint(n) < cf.min || uint(n) > cf.max {
+		err = fmt.Errorf("invalid value %s: must be between %d and %d", s, cf.min, cf.max)
+		return
+	}
+	v = uint(n)
+	return
+}
+
+func has(b uint64, v int) bool {
+	return b&(1<<uint(v)) != 0
+}
+
+func (cs *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch, dowMatch := has(cs.dom, t.Day()), has(cs.dow, int(t.Weekday()))
+	if cs.domStar || cs.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// maxCronYears bounds the search for a matching time (e.g. for "0 0 30 2 *", which never matches)
+const maxCronYears = 5
+
+// next returns the first time matching the schedule strictly after t, or the zero time if there is none
+func (cs *cronSchedule) next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxCronYears, 0, 0)
+	for t.Before(limit) {
+		var c time.Time
+		switch {
+		case !has(cs.month, int(t.Month())):
+			c = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !cs.dayMatches(t):
+			c = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !has(cs.hour, t.Hour()):
+			c = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case !has(cs.minute, t.Minute()):
+			c = t.Add(time.Minute)
+		default:
+			return t
+		}
+		// time.Date may normalize a wall time skipped by a daylight saving time change backwards
+		if !c.After(t) {
+			c = t.Add(time.Minute)
+		}
+		t = c
+	}
+	return time.Time{}
+}
+
+// prev returns the last time matching the schedule at or before t, or the zero time if there is none
+func (cs *cronSchedule) prev(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute)
+	limit := t.AddDate(-maxCronYears, 0, 0)
+	for t.After(limit) {
+		var c time.Time
+		switch {
+		case !has(cs.month, int(t.Month())):
+			c = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc).Add(-time.Minute)
+		case !cs.dayMatches(t):
+			c = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc).Add(-time.Minute)
+		case !has(cs.hour, t.Hour()):
+			c = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc).Add(-time.Minute)
+		case !has(cs.minute, t.Minute()):
+			c = t.Add(-time.Minute)
+		default:
+			return t
+		}
+		if !c.Before(t) {
+			c = t.Add(-time.Minute)
+		}
+		t = c
+	}
+	return time.Time{}
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr   string
+		minute uint64
+		hour   uint64
+		dow    uint64
+		err    string
+	}{
+		{expr: "0 0 * * *", minute: 1, hour: 1, dow: 1<<8 - 1},
+		{expr: "@daily", minute: 1, hour: 1, dow: 1<<8 - 1},
+		{expr: " @HOURLY ", minute: 1, hour: 1<<24 - 1, dow: 1<<8 - 1},
+		{expr: "0,30 1-3 * * *", minute: 1 | 1<<30, hour: 1<<1 | 1<<2 | 1<<3, dow: 1<<8 - 1},
+		{expr: "*/15 */6 * * 1-5", minute: 1 | 1<<15 | 1<<30 | 1<<45, hour: 1 | 1<<6 | 1<<12 | 1<<18, dow: 1<<1 | 1<<2 | 1<<3 | 1<<4 | 1<<5},
+		{expr: "10/20 8-12/2 * * *", minute: 1<<10 | 1<<30 | 1<<50, hour: 1<<8 | 1<<10 | 1<<12, dow: 1<<8 - 1},
+		// 7 is Sunday as well as 0
+		{expr: "0 0 * * 7", minute: 1, hour: 1, dow: 1 | 1<<7},
+		{expr: "0 0 * *", err: "expected 5 fields"},
+		{expr: "60 0 * * *", err: "invalid value 60"},
+		{expr: "0 24 * * *", err: "invalid value 24"},
+		{expr: "0 0 0 * *", err: "invalid value 0"},
+		{expr: "0 0 * 13 *", err: "invalid value 13"},
+		{expr: "0 0 * * 8", err: "invalid value 8"},
+		{expr: "0 5-1 * * *", err: "invalid range 5-1"},
+		{expr: "*/0 * * * *", err: "invalid step 0"},
+		{expr: "*/x * * * *", err: "invalid step x"},
+		{expr: "a * * * *", err: "invalid value a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			cs, err := parseCron(tt.expr)
+			if tt.err != Empty {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cs.minute != tt.minute || cs.hour != tt.hour || cs.dow != tt.dow {
+				t.Errorf("got minute %b, hour %b, dow %b", cs.minute, cs.hour, cs.dow)
+			}
+		})
+	}
+}
+
+func TestCronNextPrev(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	date := func(loc *time.Location, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, loc)
+	}
+	tests := []struct {
+		name string
+		expr string
+		at   time.Time
+		next time.Time
+		prev time.Time
+	}{
+		{name: "hourly", expr: "@hourly", at: date(time.UTC, 5, 1, 10, 30), next: date(time.UTC, 5, 1, 11, 0), prev: date(time.UTC, 5, 1, 10, 0)},
+		// next is strictly after, prev at or before
+		{name: "on a run", expr: "@hourly", at: date(time.UTC, 5, 1, 10, 0), next: date(time.UTC, 5, 1, 11, 0), prev: date(time.UTC, 5, 1, 10, 0)},
+		{name: "end of year", expr: "0 0 1 1 *", at: date(time.UTC, 12, 31, 23, 59), next: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), prev: date(time.UTC, 1, 1, 0, 0)},
+		// 2024-05-05 is a Sunday
+		{name: "sunday as 7", expr: "0 12 * * 7", at: date(time.UTC, 5, 1, 0, 0), next: date(time.UTC, 5, 5, 12, 0), prev: date(time.UTC, 4, 28, 12, 0)},
+		// either of a restricted day of month and day of week matches
+		{name: "dom or dow", expr: "0 0 10 * 0", at: date(time.UTC, 5, 6, 0, 0), next: date(time.UTC, 5, 10, 0, 0), prev: date(time.UTC, 5, 5, 0, 0)},
+		// 2:30 does not exist on 2024-03-10 in New York
+		{name: "spring forward", expr: "30 2 * * *", at: date(ny, 3, 10, 1, 0), next: date(ny, 3, 11, 2, 30), prev: date(ny, 3, 9, 2, 30)},
+		{name: "daily across spring forward", expr: "@daily", at: date(ny, 3, 10, 12, 0), next: date(ny, 3, 11, 0, 0), prev: date(ny, 3, 10, 0, 0)},
+		{name: "hourly across spring forward", expr: "@hourly", at: date(ny, 3, 10, 1, 30), next: date(ny, 3, 10, 3, 0), prev: date(ny, 3, 10, 1, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if next := cs.next(tt.at); !next.Equal(tt.next) {
+				t.Errorf("got next %v, want %v", next, tt.next)
+			}
+			if prev := cs.prev(tt.at); !prev.Equal(tt.prev) {
+				t.Errorf("got prev %v, want %v", prev, tt.prev)
+			}
+		})
+	}
+	// a schedule which never runs
+	cs, _ := parseCron("0 0 30 2 *")
+	if next, prev := cs.next(date(time.UTC, 1, 1, 0, 0)), cs.prev(date(time.UTC, 1, 1, 0, 0)); !next.IsZero() || !prev.IsZero() {
+		t.Errorf("got next %v, prev %v", next, prev)
+	}
+}
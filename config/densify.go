@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+func (dp *DensifyParameters) finalize() (err error) {
+	if dp.UrlConfig == nil || dp.UrlConfig.Host == Empty {
+		return fmt.Errorf("url host must be set")
+	}
+	if dp.UrlConfig.Scheme == Empty {
+		dp.UrlConfig.Scheme = defDensifyScheme
+	}
+	if dp.Endpoint == Empty {
+		dp.Endpoint = defDensifyEndpoint
+	}
+	if err = dp.UrlConfig.finalize(); err == nil {
+		if _, err = dp.EndpointURL(); err == nil {
+			if err = dp.finalizeAuth(); err == nil {
+				err = dp.RetryConfig.Validate()
+			}
+		}
+	}
+	return
+}
+
+// EndpointURL returns the url of the endpoint, joined with path (if any). The endpoint must be an
+// absolute path, which is appended to the path the host may carry (e.g. behind a reverse proxy); neither
+// may contain "." or ".." segments, and the path of the host must not end with the start of the endpoint
+// (e.g. host densify.com/api/v2 with endpoint /api/v2/). A trailing slash of the endpoint, or of the last path element, is kept
+func (dp *DensifyParameters) EndpointURL(path ...string) (u *url.URL, err error) {
+	if dp.UrlConfig == nil || dp.UrlConfig.Url == Empty {
+		err = fmt.Errorf("densify url is not set")
+		return
+	}
+	if u, err = url.Parse(dp.UrlConfig.Url); err != nil {
+		return
+	}
+	var ep *url.URL
+	if ep, err = url.Parse(dp.Endpoint); err != nil {
+		err = fmt.Errorf("invalid densify endpoint %s: %w", dp.Endpoint, err)
+		return
+	}
+	switch {
+	case ep.Scheme != Empty || ep.Host != Empty || ep.RawQuery != Empty || ep.Fragment != Empty:
+		err = fmt.Errorf("invalid densify endpoint %s: must be a path only", dp.Endpoint)
+	case !strings.HasPrefix(ep.Path, Slash):
+		err = fmt.Errorf("invalid densify endpoint %s: must be an absolute path", dp.Endpoint)
+	case hasDotSegment(ep.Path):
+		err = fmt.Errorf("invalid densify endpoint %s: must not contain . or .. segments", dp.Endpoint)
+	case hasDotSegment(u.Path):
+		err = fmt.Errorf("path %s of densify host %s must not contain . or .. segments", u.Path, dp.UrlConfig.Host)
+	case pathsOverlap(u.Path, ep.Path):
+		err = fmt.Errorf("path %s of densify host %s overlaps the densify endpoint %s, remove it from either", u.Path, dp.UrlConfig.Host, dp.Endpoint)
+	}
+	if err == nil {
+		u = u.JoinPath(ep.EscapedPath())
+		base := u.Path
+		if u = u.JoinPath(path...); !hasPathPrefix(u.Path, base) {
+			err = fmt.Errorf("path %s escapes the densify endpoint %s", strings.Join(path, Slash), dp.Endpoint)
+		}
+	}
+	if err != nil {
+		u = nil
+	}
+	return
+}
+
+func hasDotSegment(p string) bool {
+	for _, seg := range strings.Split(p, Slash) {
+		if seg == "." || seg == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// pathsOverlap reports whether the last segments of base are the first segments of p, empty segments aside
+func pathsOverlap(base, p string) bool {
+	bs, ps := pathSegments(base), pathSegments(p)
+	for n := min(len(bs), len(ps)); n > 0; n-- {
+		if slices.Equal(bs[len(bs)-n:], ps[:n]) {
+			return true
+		}
+	}
+	return false
+}
+
+func pathSegments(p string) []string {
+	return slices.DeleteFunc(strings.Split(p, Slash), func(seg string) bool { return seg == Empty })
+}
+
+// hasPathPrefix reports whether p is either prefix or a path under it, ignoring trailing slashes of prefix
+func hasPathPrefix(p, prefix string) bool {
+	prefix = strings.TrimRight(prefix, Slash)
+	return prefix == Empty || p == prefix || strings.HasPrefix(p, prefix+Slash)
+}
@@ -0,0 +1,58 @@
+package config
+
+import "testing"
+
+func TestEndpointURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		host     string
+		endpoint string
+		path     []string
+		want     string
+		err      bool
+	}{
+		{name: "default", host: "densify.com", endpoint: "/api/v2/", want: "https://densify.com/api/v2/"},
+		{name: "no trailing slash", host: "densify.com", endpoint: "/api/v2", want: "https://densify.com/api/v2"},
+		{name: "host trailing slash", host: "densify.com/", endpoint: "/api/v2/", want: "https://densify.com/api/v2/"},
+		{name: "host path", host: "x/densify", endpoint: "/api/v2/", want: "https://x/densify/api/v2/"},
+		{name: "host path trailing slash", host: "x/densify/", endpoint: "/api/v2/", want: "https://x/densify/api/v2/"},
+		{name: "double slash", host: "densify.com", endpoint: "/api//v2/", want: "https://densify.com/api/v2/"},
+		{name: "network-path reference", host: "densify.com", endpoint: "//other.com/api/v2/", err: true},
+		{name: "root", host: "densify.com", endpoint: "/", want: "https://densify.com/"},
+		{name: "path", host: "densify.com", endpoint: "/api/v2/", path: []string{"upload"}, want: "https://densify.com/api/v2/upload"},
+		{name: "path trailing slash", host: "densify.com", endpoint: "/api/v2", path: []string{"upload/"}, want: "https://densify.com/api/v2/upload/"},
+		{name: "path elements", host: "x/densify", endpoint: "/api/v2/", path: []string{"a", "b"}, want: "https://x/densify/api/v2/a/b"},
+		{name: "escaped", host: "densify.com", endpoint: "/api/v2%2Fx/", want: "https://densify.com/api/v2%2Fx/"},
+		{name: "relative", host: "densify.com", endpoint: "api/v2/", err: true},
+		{name: "absolute url", host: "densify.com", endpoint: "https://other.com/api/v2/", err: true},
+		{name: "query", host: "densify.com", endpoint: "/api/v2/?a=b", err: true},
+		{name: "dot dot", host: "densify.com", endpoint: "/api/../v2/", err: true},
+		{name: "host dot dot", host: "x/densify/..", endpoint: "/api/v2/", err: true},
+		{name: "host path is the endpoint", host: "densify.com/api/v2", endpoint: "/api/v2/", err: true},
+		{name: "host path ends with the endpoint", host: "x/densify/api/v2/", endpoint: "/api/v2", err: true},
+		{name: "host path overlaps the endpoint", host: "x/api", endpoint: "/api/v2/", err: true},
+		{name: "host path contains the endpoint", host: "x/api/v2/densify", endpoint: "/api/v2/", want: "https://x/api/v2/densify/api/v2/"},
+		{name: "path escapes", host: "densify.com", endpoint: "/api/v2/", path: []string{"..", "admin"}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dp := &DensifyParameters{UrlConfig: &UrlConfig{Scheme: Https, Host: tt.host}, Endpoint: tt.endpoint}
+			if err := dp.UrlConfig.finalize(); err != nil {
+				t.Fatal(err)
+			}
+			u, err := dp.EndpointURL(tt.path...)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", u)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := u.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// destination types
+const (
+	DestinationDensify = "densify"
+	DestinationFile    = "file"
+	DestinationS3      = "s3"
+)
+
+// FileDestination writes the output zip file to a local directory
+type FileDestination struct {
+	Dir string `yaml:"dir"`
+}
+
+// S3Destination uploads the output zip file to an S3 (or S3-compatible, e.g. MinIO) bucket
+type S3Destination struct {
+	Bucket string `yaml:"bucket"`
+	// Prefix is the key prefix of the uploaded objects
+	Prefix string `yaml:"prefix,omitempty"`
+	Region string `yaml:"region,omitempty"`
+	// Endpoint is the url of an S3-compatible service, if omitted AWS S3 is used
+	Endpoint *UrlConfig `yaml:"endpoint,omitempty"`
+	// PathStyle addresses the bucket in the url path rather than in the host name, as most
+	// S3-compatible services require
+	PathStyle bool `yaml:"path_style,omitempty"`
+	// AccessKeyId and SecretAccessKey are values or filenames, if omitted the default AWS credentials chain is used
+	AccessKeyId     string `yaml:"access_key_id,omitempty"`
+	SecretAccessKey string `yaml:"secret_access_key,omitempty"`
+}
+
+// Destination is an entry of the forwarder destinations; exactly one of Densify, File and S3 is set,
+// Type is inferred from it if omitted
+type Destination struct {
+	Name    string             `yaml:"name,omitempty"`
+	Type    string             `yaml:"type,omitempty"`
+	Densify *DensifyParameters `yaml:"densify,omitempty"`
+	File    *FileDestination   `yaml:"file,omitempty"`
+	S3      *S3Destination     `yaml:"s3,omitempty"`
+}
+
+func (d *Destination) typ() (typ string, err error) {
+	var types []string
+	if d.Densify != nil {
+		types = append(types, DestinationDensify)
+	}
+	if d.File != nil {
+		types = append(types, DestinationFile)
+	}
+	if d.S3 != nil {
+		types = append(types, DestinationS3)
+	}
+	switch len(types) {
+	case 0:
+		err = fmt.Errorf("one of %s, %s or %s must be set", DestinationDensify, DestinationFile, DestinationS3)
+	case 1:
+		typ = types[0]
+		if d.Type != Empty && !strings.EqualFold(d.Type, typ) {
+			err = fmt.Errorf("type %s does not match the %s section", d.Type, typ)
+		}
+	default:
+		err = fmt.Errorf("only one of %s may be set", strings.Join(types, ", "))
+	}
+	return
+}
+
+func (d *Destination) finalize() (err error) {
+	if d.Type, err = d.typ(); err != nil {
+		return
+	}
+	if d.Name == Empty {
+		d.Name = d.Type
+	}
+	switch d.Type {
+	case DestinationDensify:
+		err = d.Densify.finalize()
+	case DestinationFile:
+		if d.File.Dir == Empty {
+			err = fmt.Errorf("dir must be set")
+		}
+	case DestinationS3:
+		err = d.S3.finalize()
+	}
+	return
+}
+
+func (s3 *S3Destination) finalize() (err error) {
+	if s3.Bucket == Empty {
+		return fmt.Errorf("bucket must be set")
+	}
+	if (s3.AccessKeyId == Empty) != (s3.SecretAccessKey == Empty) {
+		return fmt.Errorf("access_key_id and secret_access_key must be set together")
+	}
+	if s3.Endpoint != nil {
+		err = s3.Endpoint.finalize()
+	}
+	return
+}
+
+// MarshalYAML omits what is derived at finalize time - the densify section from the destinations, or the
+// destinations from the densify section - so the result can be read back
+func (fp ForwarderParameters) MarshalYAML() (any, error) {
+	type plain ForwarderParameters
+	c := plain(fp)
+	switch {
+	case fp.implicitDestinations:
+		c.Destinations = nil
+	case len(fp.Destinations) > 0:
+		c.Densify = nil
+	}
+	return c, nil
+}
+
+// finalizeDestinations validates the destinations; if there are none, the densify section is the single
+// destination, otherwise the densify section must not be given and is set to the first densify destination
+// (nil if there is none)
+func (fp *ForwarderParameters) finalizeDestinations() error {
+	if len(fp.Destinations) == 0 || fp.implicitDestinations {
+		fp.Destinations = []*Destination{{Name: DestinationDensify, Type: DestinationDensify, Densify: fp.Densify}}
+		fp.implicitDestinations = true
+		return nil
+	}
+	if fp.explicitDensify {
+		return fmt.Errorf("the densify section and destinations are mutually exclusive, add a %s destination instead", DestinationDensify)
+	}
+	names := make(map[string]bool, len(fp.Destinations))
+	var densify *DensifyParameters
+	for i, d := range fp.Destinations {
+		if d == nil {
+			return fmt.Errorf("destination %d is empty", i)
+		}
+		if err := d.finalize(); err != nil {
+			return fmt.Errorf("destination %d (%s): %w", i, d.Name, err)
+		}
+		if names[d.Name] {
+			return fmt.Errorf("duplicate destination name %s, destinations of the same type must be named", d.Name)
+		}
+		names[d.Name] = true
+		if densify == nil {
+			densify = d.Densify
+		}
+	}
+	fp.Densify = densify
+	return nil
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"bytes"
+	"testing"
+)
+
+const (
+	fileDestination    = "  destinations:\n    - file:\n        dir: /tmp/out\n"
+	densifyDestination = "    - densify:\n        url:\n          host: new.densify.com\n"
+)
+
+func TestDestinations(t *testing.T) {
+	tests := []struct {
+		name         string
+		forwarder    string
+		args         []string
+		densify      string
+		destinations int
+		err          bool
+	}{
+		{name: "densify section", forwarder: "  densify:\n    url:\n      host: old.densify.com\n", densify: "old.densify.com", destinations: 1},
+		{name: "defaults", densify: defDensifyHost, destinations: 1},
+		{name: "file only", forwarder: fileDestination, destinations: 1},
+		{name: "densify destination", forwarder: fileDestination + densifyDestination, densify: "new.densify.com", destinations: 2},
+		{name: "densify section and destinations", forwarder: "  densify:\n    url:\n      host: old.densify.com\n" + fileDestination, err: true},
+		{name: "densify key and destinations", forwarder: fileDestination, args: []string{"--" + densifyHost + "=old.densify.com"}, err: true},
+		{name: "densify override and destinations", forwarder: fileDestination, args: []string{"--set", "forwarder.densify.endpoint=/api/v3/"}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := loadDir(t, map[string]string{"config.yaml": "prometheus:\n  url:\n    host: prom\nforwarder:\n" + tt.forwarder}, tt.args...)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var densify string
+			if dp := p.Forwarder.Densify; dp != nil {
+				densify = dp.UrlConfig.Host
+			}
+			if densify != tt.densify || len(p.Forwarder.Destinations) != tt.destinations {
+				t.Errorf("got densify %q and %d destinations, want %q and %d", densify, len(p.Forwarder.Destinations), tt.densify, tt.destinations)
+			}
+			// the encoded config reads back to the same one
+			b, err := p.Encode(FormatYaml)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var q *Parameters
+			if q, err = LoadFromReader(bytes.NewReader(b), FormatYaml); err != nil {
+				t.Fatalf("%v:\n%s", err, b)
+			}
+			if changes := Diff(p, q); len(changes) > 0 {
+				t.Errorf("encoded config differs: %v", changes)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// change kinds
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// Masked replaces the values of secrets in a Change
+const Masked = "******"
+
+// secretFields are the yaml names of the fields holding secrets (or the names of files containing them)
+var secretFields = map[string]bool{
+	"password":           true,
+	"encrypted_password": true,
+	"bearer_token":       true,
+	"token":              true,
+	"client_secret":      true,
+	"subject_token":      true,
+	"secret_access_key":  true,
+	"secret_key":         true,
+}
+
+// Change is a difference between two Parameters: Path is the yaml path of the field (list elements
+// with a name, e.g. clusters, are matched and addressed by name), Old and New are its values, with
+// secrets masked
+type Change struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case ChangeAdded:
+		return fmt.Sprintf("+ %s: %s", c.Path, c.New)
+	case ChangeRemoved:
+		return fmt.Sprintf("- %s: %s", c.Path, c.Old)
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", c.Path, c.Old, c.New)
+}
+
+// Diff returns the differences between a and b, in the order of the fields (map keys and list elements
+// by name); only the fields which are (un)marshalled are compared, the ones derived from them at finalize
+// time are not
+func Diff(a, b *Parameters) (changes []Change) {
+	return diffValues(nil, Empty, false, reflect.ValueOf(a), reflect.ValueOf(b))
+}
+
+func diffValues(changes []Change, path string, secret bool, a, b reflect.Value) []Change {
+	t := a.Type()
+	if isLeafType(t) || isPlainList(t) {
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			changes = append(changes, newChange(path, secret, a, b))
+		}
+		return changes
+	}
+	a, b = deref(a), deref(b)
+	switch a.Kind() {
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			name, inline := yamlTag(a.Type().Field(i))
+			switch {
+			case isDerived(a, name) && isDerived(b, name):
+			case inline:
+				changes = diffValues(changes, path, secret, a.Field(i), b.Field(i))
+			case name != Empty:
+				changes = diffValues(changes, joinPath(path, name), secretFields[name], a.Field(i), b.Field(i))
+			}
+		}
+	case reflect.Map:
+		keys := make(map[string]reflect.Value)
+		for _, m := range []reflect.Value{a, b} {
+			for _, k := range m.MapKeys() {
+				keys[fmt.Sprint(k.Interface())] = k
+			}
+		}
+		zero := reflect.Zero(a.Type().Elem())
+		for _, ks := range sortedKeys(keys) {
+			av, bv := a.MapIndex(keys[ks]), b.MapIndex(keys[ks])
+			if !av.IsValid() {
+				av = zero
+			}
+			if !bv.IsValid() {
+				bv = zero
+			}
+			changes = diffValues(changes, joinPath(path, ks), secret, av, bv)
+		}
+	case reflect.Slice:
+		// elements are matched by name, or by index if the names of either list are not unique
+		as, aUnique := namedElems(a)
+		bs, bUnique := namedElems(b)
+		if !aUnique || !bUnique {
+			as, bs = indexedElems(a), indexedElems(b)
+		}
+		zero := reflect.Zero(t.Elem())
+		names := maps.Clone(as)
+		maps.Copy(names, bs)
+		for _, name := range sortedKeys(names) {
+			av, af := as[name]
+			bv, bf := bs[name]
+			if !af {
+				av = zero
+			}
+			if !bf {
+				bv = zero
+			}
+			changes = diffValues(changes, fmt.Sprintf("%s[%s]", path, name), secret, av, bv)
+		}
+	}
+	return changes
+}
+
+// derivedFields is implemented by the structs some fields of which may be derived from others at
+// finalize time, which Diff skips so each difference is reported once
+type derivedFields interface {
+	derived(name string) bool
+}
+
+func isDerived(v reflect.Value, name string) bool {
+	df, ok := v.Interface().(derivedFields)
+	return ok && df.derived(name)
+}
+
+func (fp ForwarderParameters) derived(name string) bool {
+	return fp.implicitDestinations && name == "destinations"
+}
+
+func (dp DensifyParameters) derived(name string) bool {
+	return dp.implicitAuth && name == "auth"
+}
+
+// isPlainList reports whether t is a (pointer to a) list compared as a whole, i.e. not a named list
+func isPlainList(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Slice && !isNamedList(t)
+}
+
+// isNamedList reports whether t is a list of structs with a name field, whose elements are matched by name
+func isNamedList(t reflect.Type) bool {
+	e := t.Elem()
+	for e.Kind() == reflect.Pointer {
+		e = e.Elem()
+	}
+	if e.Kind() != reflect.Struct {
+		return false
+	}
+	_, ok := structFieldByYamlName(e, "name")
+	return ok
+}
+
+// namedElems maps the elements of a list by name, an element without a name is named by its index; unique
+// is false if names are not unique (e.g. in parameters not finalized)
+func namedElems(v reflect.Value) (m map[string]reflect.Value, unique bool) {
+	m = make(map[string]reflect.Value, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		name := strconv.Itoa(i)
+		if e := deref(v.Index(i)); e.IsValid() {
+			if n := e.FieldByName("Name").String(); n != Empty {
+				name = n
+			}
+		}
+		if _, dup := m[name]; dup {
+			return nil, false
+		}
+		m[name] = v.Index(i)
+	}
+	return m, true
+}
+
+func indexedElems(v reflect.Value) map[string]reflect.Value {
+	m := make(map[string]reflect.Value, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		m[strconv.Itoa(i)] = v.Index(i)
+	}
+	return m
+}
+
+// deref dereferences pointers, a nil pointer is dereferenced to the zero value of its type
+func deref(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v = reflect.Zero(v.Type().Elem())
+		} else {
+			v = v.Elem()
+		}
+	}
+	return v
+}
+
+func newChange(path string, secret bool, a, b reflect.Value) Change {
+	c := Change{Path: path, Kind: ChangeModified, Old: formatValue(a), New: formatValue(b)}
+	switch {
+	case isUnset(a):
+		c.Kind = ChangeAdded
+	case isUnset(b):
+		c.Kind = ChangeRemoved
+	}
+	if secret {
+		for _, s := range []*string{&c.Old, &c.New} {
+			if *s != Empty {
+				*s = Masked
+			}
+		}
+	}
+	return c
+}
+
+// isUnset reports whether v is a nil pointer, or the zero value of a non-pointer: a pointer to a zero
+// value is set (e.g. offset: 0 of a cluster collection)
+func isUnset(v reflect.Value) bool {
+	if v.Kind() == reflect.Pointer {
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
+
+func formatValue(v reflect.Value) string {
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		return Empty
+	}
+	set := v.Kind() == reflect.Pointer
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+	v = deref(v)
+	if v.Kind() == reflect.Slice {
+		elems := make([]string, v.Len())
+		for i := range elems {
+			elems[i] = formatValue(v.Index(i))
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	}
+	if v.IsZero() && !set {
+		return Empty
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, cmp.Compare)
+	return keys
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	clusters := func(cs ...*ClusterFilterParameters) *Parameters { return &Parameters{Clusters: cs} }
+	tests := []struct {
+		name string
+		a, b *Parameters
+		want []Change
+	}{
+		{name: "equal", a: clusters(&ClusterFilterParameters{Name: "c0"}), b: clusters(&ClusterFilterParameters{Name: "c0"})},
+		{name: "secrets are masked",
+			a:    &Parameters{Prometheus: &PrometheusParameters{UrlConfig: &UrlConfig{Username: "u", Password: "old"}}},
+			b:    &Parameters{Prometheus: &PrometheusParameters{UrlConfig: &UrlConfig{Username: "v", Password: "new"}, BearerToken: "t"}},
+			want: []Change{{Path: "prometheus.url.username", Kind: ChangeModified, Old: "u", New: "v"}, {Path: "prometheus.url.password", Kind: ChangeModified, Old: Masked, New: Masked}, {Path: "prometheus.bearer_token", Kind: ChangeAdded, New: Masked}}},
+		{name: "secrets of a list element are masked",
+			a:    &Parameters{Forwarder: &ForwarderParameters{Destinations: []*Destination{{Name: "d", Densify: &DensifyParameters{Auth: &DensifyAuth{Token: &TokenAuth{Token: "old"}}}}}}},
+			b:    &Parameters{Forwarder: &ForwarderParameters{Destinations: []*Destination{{Name: "d", Densify: &DensifyParameters{Auth: &DensifyAuth{Token: &TokenAuth{}}}}}}},
+			want: []Change{{Path: "forwarder.destinations[d].densify.auth.token.token", Kind: ChangeRemoved, Old: Masked}}},
+		{name: "matched by name",
+			a:    clusters(&ClusterFilterParameters{Name: "c0"}, &ClusterFilterParameters{Name: "c1", Description: "one"}),
+			b:    clusters(&ClusterFilterParameters{Name: "c1", Description: "first"}, &ClusterFilterParameters{Name: "c0"}),
+			want: []Change{{Path: "clusters[c1].description", Kind: ChangeModified, Old: "one", New: "first"}}},
+		{name: "added element",
+			a:    clusters(&ClusterFilterParameters{Name: "c0"}),
+			b:    clusters(&ClusterFilterParameters{Name: "c0"}, &ClusterFilterParameters{Name: "c1", Tags: map[string]string{"env": "prod"}}),
+			want: []Change{{Path: "clusters[c1].name", Kind: ChangeAdded, New: "c1"}, {Path: "clusters[c1].tags.env", Kind: ChangeAdded, New: "prod"}}},
+		{name: "removed element",
+			a:    clusters(&ClusterFilterParameters{Name: "c0"}, &ClusterFilterParameters{Name: "c1"}),
+			b:    clusters(&ClusterFilterParameters{Name: "c1"}),
+			want: []Change{{Path: "clusters[c0].name", Kind: ChangeRemoved, Old: "c0"}}},
+		{name: "unnamed elements by index",
+			a:    clusters(&ClusterFilterParameters{Description: "a"}),
+			b:    clusters(&ClusterFilterParameters{Description: "b"}),
+			want: []Change{{Path: "clusters[0].description", Kind: ChangeModified, Old: "a", New: "b"}}},
+		{name: "duplicate names by index",
+			a:    clusters(&ClusterFilterParameters{Name: "c0", Description: "a"}, &ClusterFilterParameters{Name: "c0", Description: "b"}),
+			b:    clusters(&ClusterFilterParameters{Name: "c0", Description: "a"}, &ClusterFilterParameters{Name: "c0", Description: "c"}),
+			want: []Change{{Path: "clusters[1].description", Kind: ChangeModified, Old: "b", New: "c"}}},
+		{name: "plain list as a whole",
+			a:    &Parameters{Collection: &CollectionParameters{NodeGroupList: StringList{"a", "b"}}},
+			b:    &Parameters{Collection: &CollectionParameters{NodeGroupList: StringList{"b", "a"}}},
+			want: []Change{{Path: "collection.node_group_list", Kind: ChangeModified, Old: "a,b", New: "b,a"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diff(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangeString(t *testing.T) {
+	for c, want := range map[Change]string{
+		{Path: "debug", Kind: ChangeAdded, New: "true"}:                        "+ debug: true",
+		{Path: "debug", Kind: ChangeRemoved, Old: "true"}:                      "- debug: true",
+		{Path: "collection.history", Kind: ChangeModified, Old: "1", New: "2"}: "~ collection.history: 1 -> 2",
+	} {
+		if got := c.String(); got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+}
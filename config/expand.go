@@ -0,0 +1,121 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	expandStart   = "${"
+	expandEnd     = "}"
+	expandDefault = ":-"
+)
+
+// expandEnv replaces, in all scalar values of n, ${VAR} with the value of the environment variable VAR and
+// ${VAR:-default} with the value of VAR, or default if VAR is unset or empty. $${ is an escaped literal ${.
+// An unset variable without a default is an error naming the yaml path of the value, at its position
+func expandEnv(d *document) error {
+	var errs []error
+	expandNode(d, d.root, Empty, &errs)
+	return errors.Join(errs...)
+}
+
+func expandNode(d *document, n *yaml.Node, path string, errs *[]error) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, c := range n.Content {
+			expandNode(d, c, path, errs)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			expandNode(d, n.Content[i+1], joinPath(path, n.Content[i].Value), errs)
+		}
+	case yaml.SequenceNode:
+		for i, c := range n.Content {
+			expandNode(d, c, path+"["+strconv.Itoa(i)+"]", errs)
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(n.Value, expandStart) {
+			return
+		}
+		s, err := expandString(n.Value)
+		if err != nil {
+			*errs = append(*errs, d.errorAt(n, fmt.Errorf("%s: %w", path, err)))
+			return
+		}
+		n.Value = s
+		// let a plain scalar be resolved again, so e.g. a number can be decoded into a numeric field
+		if n.Style == 0 {
+			n.Tag = Empty
+		}
+	}
+}
+
+// escapeExpansion escapes each ${ in the scalar values of n as $${, so expandEnv leaves them as they are,
+// and returns whether there was any
+func escapeExpansion(n *yaml.Node) (escaped bool) {
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, c := range n.Content {
+			escaped = escapeExpansion(c) || escaped
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			escaped = escapeExpansion(n.Content[i+1]) || escaped
+		}
+	case yaml.ScalarNode:
+		if strings.Contains(n.Value, expandStart) {
+			n.Value = strings.ReplaceAll(n.Value, expandStart, "$"+expandStart)
+			escaped = true
+		}
+	}
+	return
+}
+
+func expandString(s string) (string, error) {
+	var sb strings.Builder
+	for {
+		i := strings.Index(s, expandStart)
+		if i < 0 {
+			sb.WriteString(s)
+			return sb.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			sb.WriteString(s[:i-1])
+			sb.WriteString(expandStart)
+			s = s[i+len(expandStart):]
+			continue
+		}
+		sb.WriteString(s[:i])
+		s = s[i+len(expandStart):]
+		j := strings.Index(s, expandEnd)
+		if j < 0 {
+			return Empty, fmt.Errorf("unterminated %s in value", expandStart)
+		}
+		name, def, hasDef := strings.Cut(s[:j], expandDefault)
+		s = s[j+len(expandEnd):]
+		if name == Empty {
+			return Empty, fmt.Errorf("empty environment variable name")
+		}
+		v, ok := os.LookupEnv(name)
+		switch {
+		case hasDef && v == Empty:
+			v = def
+		case !ok:
+			return Empty, fmt.Errorf("environment variable %s is not set", name)
+		}
+		sb.WriteString(v)
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == Empty {
+		return key
+	}
+	return path + Dot + key
+}
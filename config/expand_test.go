@@ -0,0 +1,91 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandString(t *testing.T) {
+	t.Setenv("EXPAND_TEST_A", "a")
+	t.Setenv("EXPAND_TEST_EMPTY", Empty)
+	tests := []struct {
+		in   string
+		want string
+		err  string
+	}{
+		{in: "no variables", want: "no variables"},
+		{in: "${EXPAND_TEST_A}", want: "a"},
+		{in: "x-${EXPAND_TEST_A}-${EXPAND_TEST_A}-y", want: "x-a-a-y"},
+		{in: "${EXPAND_TEST_UNSET:-def}", want: "def"},
+		{in: "${EXPAND_TEST_EMPTY:-def}", want: "def"},
+		{in: "${EXPAND_TEST_A:-def}", want: "a"},
+		{in: "${EXPAND_TEST_EMPTY}", want: Empty},
+		{in: "$${EXPAND_TEST_A}", want: "${EXPAND_TEST_A}"},
+		{in: "$$${EXPAND_TEST_A}", want: "$${EXPAND_TEST_A}"},
+		{in: "${EXPAND_TEST_UNSET}", err: "EXPAND_TEST_UNSET is not set"},
+		{in: "${EXPAND_TEST_A", err: "unterminated"},
+		{in: "${}", err: "empty environment variable name"},
+		{in: "${:-def}", err: "empty environment variable name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := expandString(tt.in)
+			if tt.err != Empty {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandEnvLoad(t *testing.T) {
+	t.Setenv("EXPAND_TEST_HOST", "env-prom")
+	t.Setenv("EXPAND_TEST_HISTORY", "5")
+	t.Setenv("EXPAND_TEST_DOMAIN", "env-domain")
+	files := map[string]string{
+		"config.yaml": `
+prometheus:
+  url:
+    host: ${EXPAND_TEST_HOST}
+profiles:
+  prod:
+    forwarder:
+      proxy:
+        domain: ${EXPAND_TEST_DOMAIN}
+`,
+		"overlay.yaml": "collection:\n  history: ${EXPAND_TEST_HISTORY}\n  offset: ${EXPAND_TEST_OFFSET:-2}\n",
+	}
+	args := []string{"--" + configOverlay + "=overlay.yaml", "--" + profile + "=prod"}
+	p, err := loadDir(t, files, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// an expanded plain scalar is decoded as a number
+	if p.Prometheus.UrlConfig.Host != "env-prom" || p.Collection.History != 5 || p.Collection.Offset != 2 || p.Forwarder.Proxy.Domain != "env-domain" {
+		t.Errorf("got host %s, history %d, offset %d, domain %s", p.Prometheus.UrlConfig.Host, p.Collection.History, p.Collection.Offset, p.Forwarder.Proxy.Domain)
+	}
+	// without expansion the values are kept as they are
+	if p, err = loadDir(t, map[string]string{"config.yaml": files["config.yaml"]}, "--"+configNoExpand); err != nil {
+		t.Fatal(err)
+	}
+	if p.Prometheus.UrlConfig.Host != "${EXPAND_TEST_HOST}" {
+		t.Errorf("got host %s without expansion", p.Prometheus.UrlConfig.Host)
+	}
+	// an unset variable is an error at its path and position, in the overlay
+	files["overlay.yaml"] = "collection:\n  history: ${EXPAND_TEST_UNSET}\n"
+	_, err = loadDir(t, files, args...)
+	var pe *PositionError
+	if !errors.As(err, &pe) || filepath.Base(pe.File) != "overlay.yaml" || pe.Line != 2 || !strings.Contains(err.Error(), "collection.history") {
+		t.Errorf("got error %v", err)
+	}
+}
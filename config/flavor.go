@@ -0,0 +1,290 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/sigv4"
+)
+
+// Prometheus API flavors
+const (
+	FlavorUnknown         = "unknown"
+	FlavorPrometheus      = "prometheus"
+	FlavorThanos          = "thanos"
+	FlavorVictoriaMetrics = "victoriametrics"
+	FlavorMimir           = "mimir"
+	FlavorAmp             = "amp"
+	FlavorGrafanaCloud    = "grafana-cloud"
+	// FlavorDetect is not a flavor, it has the flavor detected when loading the config, see detectFlavor
+	FlavorDetect = "detect"
+)
+
+const (
+	// flavorMaxSize bounds the size of a probe response body
+	flavorMaxSize = 1 << 20
+	// thanosStoresPath is only served by Thanos Query
+	thanosStoresPath = "/api/v1/stores"
+	// vmActiveQueriesPath is only served by VictoriaMetrics (single-node and vmselect)
+	vmActiveQueriesPath = "/api/v1/status/active_queries"
+	// mimirNoOrgId is the error of Mimir (and Cortex) when the tenant header is missing
+	mimirNoOrgId = "no org id"
+)
+
+var (
+	flavors          = []string{FlavorPrometheus, FlavorThanos, FlavorVictoriaMetrics, FlavorMimir, FlavorAmp, FlavorGrafanaCloud}
+	ampHost          = regexp.MustCompile(`^aps-workspaces\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+	grafanaCloudHost = regexp.MustCompile(`\.grafana\.net$`)
+)
+
+// hostFlavor classifies the backend by the host of the url alone, FlavorUnknown if the host is not
+// of a managed service
+func (pp *PrometheusParameters) hostFlavor() string {
+	if pp.UrlConfig == nil || pp.UrlConfig.Url == Empty {
+		return FlavorUnknown
+	}
+	u, err := url.Parse(pp.UrlConfig.Url)
+	if err != nil {
+		return FlavorUnknown
+	}
+	switch host := strings.ToLower(u.Hostname()); {
+	case ampHost.MatchString(host):
+		return FlavorAmp
+	case grafanaCloudHost.MatchString(host):
+		return FlavorGrafanaCloud
+	}
+	return FlavorUnknown
+}
+
+// finalizeFlavor validates the flavor; if it is not set it is inferred from the host of the url (when
+// it is of a managed service), and settings known not to work with the flavor are logged as warnings
+func (pp *PrometheusParameters) finalizeFlavor() error {
+	pp.Flavor = strings.ToLower(pp.Flavor)
+	hf := pp.hostFlavor()
+	switch {
+	case pp.Flavor == FlavorDetect:
+		// the settings are checked once the flavor is detected
+		return nil
+	case pp.Flavor == Empty:
+		if hf != FlavorUnknown {
+			pp.Flavor = hf
+		}
+	case !slices.Contains(flavors, pp.Flavor):
+		return fmt.Errorf("invalid prometheus flavor %s: must be one of %s or %s", pp.Flavor, strings.Join(flavors, ", "), FlavorDetect)
+	case hf != FlavorUnknown && hf != pp.Flavor:
+		slog.Warn("prometheus flavor does not match the host", "flavor", pp.Flavor, "host", pp.UrlConfig.Host)
+	}
+	pp.warnIncompatible()
+	return nil
+}
+
+// warnIncompatible logs the settings known not to work with the flavor
+func (pp *PrometheusParameters) warnIncompatible() {
+	basic := pp.UrlConfig != nil && pp.UrlConfig.Username != Empty
+	if pp.SigV4Config != nil && pp.Flavor != FlavorAmp {
+		slog.Warn("sigv4 is only supported by Amazon Managed Prometheus", "flavor", pp.flavorOrUnknown())
+	}
+	if pp.Flavor == FlavorAmp {
+		if pp.SigV4Config == nil {
+			slog.Warn("Amazon Managed Prometheus requires sigv4")
+		} else if basic || pp.BearerToken != Empty {
+			slog.Warn("Amazon Managed Prometheus ignores basic auth and bearer_token, the requests are signed with sigv4")
+		}
+	}
+	if pp.Flavor == FlavorGrafanaCloud && !basic {
+		slog.Warn("Grafana Cloud requires basic auth, the instance ID as username and an access policy token as password")
+	}
+}
+
+func (pp *PrometheusParameters) flavorOrUnknown() string {
+	if pp.Flavor == Empty {
+		return FlavorUnknown
+	}
+	return pp.Flavor
+}
+
+// DetectFlavor probes Prometheus to classify its backend: by the host for managed services, otherwise
+// by the buildinfo response (its application field and Server header) and by the endpoints only some
+// backends serve. If the flavor is not set it is set to the detected one (unless FlavorUnknown), and the
+// settings known not to work with it are logged as warnings; if it is set and differs, a warning is logged.
+// pp must be finalized
+func (pp *PrometheusParameters) DetectFlavor(ctx context.Context, opts ...PreflightOption) (flavor string, err error) {
+	if flavor = pp.hostFlavor(); flavor == FlavorUnknown {
+		o := &preflightOptions{}
+		for _, opt := range opts {
+			opt(o)
+		}
+		if flavor, err = pp.probeFlavor(ctx, o); err != nil {
+			return
+		}
+	}
+	switch {
+	case flavor == FlavorUnknown:
+	case pp.Flavor == Empty:
+		pp.Flavor = flavor
+		pp.warnIncompatible()
+	case pp.Flavor != flavor:
+		slog.Warn("prometheus flavor does not match the detected one", "flavor", pp.Flavor, "detected", flavor)
+	}
+	return
+}
+
+// detectFlavor replaces FlavorDetect by the flavor found by DetectFlavor, or inferred from the host alone
+// when offline. A failed detection is logged as a warning and leaves the flavor inferred from the host (if
+// any), as does an unknown backend
+func (pp *PrometheusParameters) detectFlavor(ctx context.Context, offline bool) {
+	if pp.Flavor != FlavorDetect {
+		return
+	}
+	pp.Flavor = Empty
+	if !offline {
+		flavor, err := pp.DetectFlavor(ctx)
+		if err == nil && flavor != FlavorUnknown {
+			return
+		}
+		if err != nil {
+			slog.Warn("prometheus flavor detection failed", "error", err)
+		}
+	}
+	_ = pp.finalizeFlavor()
+}
+
+// flavorResponse is a probe response, Body is truncated to flavorMaxSize
+type flavorResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+func (pp *PrometheusParameters) probeFlavor(ctx context.Context, o *preflightOptions) (flavor string, err error) {
+	if pp.UrlConfig == nil || pp.UrlConfig.Url == Empty {
+		err = fmt.Errorf("prometheus url is not set")
+		return
+	}
+	var client *http.Client
+	if client, err = pp.client(o); err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+	get := func(path string) (fr *flavorResponse, e error) {
+		var u string
+		if u, e = url.JoinPath(pp.UrlConfig.Url, path); e != nil {
+			return
+		}
+		var req *http.Request
+		if req, e = http.NewRequestWithContext(ctx, http.MethodGet, u, nil); e != nil {
+			return
+		}
+		if e = pp.authorize(req); e != nil {
+			return
+		}
+		var resp *http.Response
+		if resp, e = client.Do(req); e != nil {
+			return
+		}
+		defer func() { _ = resp.Body.Close() }()
+		fr = &flavorResponse{Status: resp.StatusCode, Header: resp.Header}
+		fr.Body, e = io.ReadAll(io.LimitReader(resp.Body, flavorMaxSize))
+		return
+	}
+	var bi *flavorResponse
+	if bi, err = get(buildInfoPath); err != nil {
+		return
+	}
+	if flavor = buildInfoFlavor(bi); flavor != FlavorUnknown {
+		return
+	}
+	for _, probe := range []struct {
+		path   string
+		flavor string
+	}{
+		{thanosStoresPath, FlavorThanos},
+		{vmActiveQueriesPath, FlavorVictoriaMetrics},
+	} {
+		var fr *flavorResponse
+		if fr, err = get(probe.path); err != nil {
+			return
+		}
+		if fr.Status == http.StatusOK {
+			flavor = probe.flavor
+			return
+		}
+	}
+	if bi.Status == http.StatusOK {
+		flavor = FlavorPrometheus
+	}
+	return
+}
+
+// buildInfoFlavor classifies the backend by the buildinfo response: Mimir sets its application name
+// (and rejects requests without a tenant), the others may be told by the Server header
+func buildInfoFlavor(fr *flavorResponse) string {
+	if fr.Status == http.StatusUnauthorized && strings.Contains(strings.ToLower(string(fr.Body)), mimirNoOrgId) {
+		return FlavorMimir
+	}
+	server := strings.ToLower(fr.Header.Get("Server"))
+	for _, f := range []string{FlavorVictoriaMetrics, FlavorThanos, FlavorMimir} {
+		if strings.Contains(server, f) {
+			return f
+		}
+	}
+	if fr.Status == http.StatusOK {
+		var bi struct {
+			Data struct {
+				Application string `json:"application"`
+			} `json:"data"`
+		}
+		if json.Unmarshal(fr.Body, &bi) == nil && strings.Contains(strings.ToLower(bi.Data.Application), FlavorMimir) {
+			return FlavorMimir
+		}
+	}
+	return FlavorUnknown
+}
+
+// client returns the http client of the requests to Prometheus, signing them with sigv4 if configured
+func (pp *PrometheusParameters) client(o *preflightOptions) (c *http.Client, err error) {
+	tr := pp.UrlConfig.Transport(nil)
+	if tr.TLSClientConfig, err = clientTLSConfig(o.tlsConfig, Empty, pp.CaCertPath); err != nil {
+		return
+	}
+	var rt http.RoundTripper
+	if rt, err = pp.wrap(tr); err == nil {
+		c = &http.Client{Transport: rt}
+	}
+	return
+}
+
+// authorize sets the bearer token (or else the basic auth credentials, if any) on req
+func (pp *PrometheusParameters) authorize(req *http.Request) (err error) {
+	var token, user, password string
+	if token, err = readSecret(pp.BearerToken); err != nil {
+		return
+	}
+	if token != Empty {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if pp.UrlConfig.Username != Empty {
+		if user, err = readSecret(pp.UrlConfig.Username); err == nil {
+			if password, err = readSecret(pp.UrlConfig.Password); err == nil {
+				req.SetBasicAuth(user, password)
+			}
+		}
+	}
+	return
+}
+
+// wrap signs the requests of rt with sigv4, if configured
+func (pp *PrometheusParameters) wrap(rt http.RoundTripper) (http.RoundTripper, error) {
+	if pp.SigV4Config == nil {
+		return rt, nil
+	}
+	return sigv4.NewSigV4RoundTripper(pp.SigV4Config, rt)
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBuildInfoFlavor(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		server string
+		body   string
+		want   string
+	}{
+		{name: "prometheus", status: http.StatusOK, body: `{"status":"success","data":{"version":"2.53.0"}}`, want: FlavorUnknown},
+		{name: "mimir without tenant", status: http.StatusUnauthorized, body: "no org id\n", want: FlavorMimir},
+		{name: "mimir application", status: http.StatusOK, body: `{"status":"success","data":{"application":"Grafana Mimir"}}`, want: FlavorMimir},
+		{name: "victoriametrics header", status: http.StatusOK, server: "VictoriaMetrics/v1.102.0", want: FlavorVictoriaMetrics},
+		{name: "thanos header", status: http.StatusOK, server: "Thanos", want: FlavorThanos},
+		{name: "unauthorized", status: http.StatusUnauthorized, body: "unauthorized", want: FlavorUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fr := &flavorResponse{Status: tt.status, Header: http.Header{}, Body: []byte(tt.body)}
+			if tt.server != Empty {
+				fr.Header.Set("Server", tt.server)
+			}
+			if got := buildInfoFlavor(fr); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// flavorServer serves the given paths with 200 and a buildinfo response of status with header Server
+// (if not empty), 404 otherwise; it counts the requests
+func flavorServer(t *testing.T, status int, server string, paths ...string) (srv *httptest.Server, requests *atomic.Int32) {
+	t.Helper()
+	requests = new(atomic.Int32)
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch {
+		case r.URL.Path == buildInfoPath:
+			if server != Empty {
+				w.Header().Set("Server", server)
+			}
+			w.WriteHeader(status)
+			if status == http.StatusUnauthorized {
+				_, _ = w.Write([]byte("no org id"))
+			}
+		case slices.Contains(paths, r.URL.Path):
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return
+}
+
+func TestDetectFlavor(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		server string
+		paths  []string
+		want   string
+	}{
+		{name: "prometheus", status: http.StatusOK, want: FlavorPrometheus},
+		{name: "thanos", status: http.StatusOK, paths: []string{thanosStoresPath}, want: FlavorThanos},
+		{name: "victoriametrics", status: http.StatusOK, paths: []string{vmActiveQueriesPath}, want: FlavorVictoriaMetrics},
+		{name: "victoriametrics header", status: http.StatusOK, server: "VictoriaMetrics", want: FlavorVictoriaMetrics},
+		{name: "mimir", status: http.StatusUnauthorized, want: FlavorMimir},
+		{name: "unknown", status: http.StatusInternalServerError, want: FlavorUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := flavorServer(t, tt.status, tt.server, tt.paths...)
+			pp := &PrometheusParameters{UrlConfig: serverUrl(t, srv)}
+			flavor, err := pp.DetectFlavor(t.Context())
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			if want == FlavorUnknown {
+				want = Empty
+			}
+			if flavor != tt.want || pp.Flavor != want {
+				t.Errorf("got %s, flavor set to %q, want %s", flavor, pp.Flavor, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlavorDetectOnLoad(t *testing.T) {
+	srv, requests := flavorServer(t, http.StatusOK, Empty, thanosStoresPath)
+	uc := serverUrl(t, srv)
+	port, _ := uc.Port.Number()
+	yamlDoc := fmt.Sprintf("prometheus:\n  url:\n    scheme: http\n    host: %s\n    port: %d\n  flavor: detect\n", uc.Host, port)
+	properties := fmt.Sprintf("prometheus_protocol=http\nprometheus_address=%s\nprometheus_port=%d\nprometheus_flavor=detect\n", uc.Host, port)
+	p, err := loadDir(t, map[string]string{"config.yaml": yamlDoc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Prometheus.Flavor != FlavorThanos {
+		t.Errorf("yaml: got flavor %q, want %s", p.Prometheus.Flavor, FlavorThanos)
+	}
+	if p, err = loadDir(t, map[string]string{"config.properties": properties}); err != nil {
+		t.Fatal(err)
+	}
+	if p.Prometheus.Flavor != FlavorThanos {
+		t.Errorf("properties: got flavor %q, want %s", p.Prometheus.Flavor, FlavorThanos)
+	}
+	// offline, nothing is probed
+	requests.Store(0)
+	if p, err = LoadFromReader(bytes.NewReader([]byte(yamlDoc)), FormatYaml, WithOffline()); err != nil {
+		t.Fatal(err)
+	}
+	if p.Prometheus.Flavor != Empty || requests.Load() != 0 {
+		t.Errorf("offline: got flavor %q after %d requests", p.Prometheus.Flavor, requests.Load())
+	}
+	// a failed detection is a warning
+	logs := captureLogs(t)
+	srv.Close()
+	if p, err = loadDir(t, map[string]string{"config.yaml": yamlDoc}); err != nil {
+		t.Fatal(err)
+	}
+	if p.Prometheus.Flavor != Empty || !strings.Contains(logs.String(), "prometheus flavor detection failed") {
+		t.Errorf("unreachable: got flavor %q, logs:\n%s", p.Prometheus.Flavor, logs)
+	}
+}
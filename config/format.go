@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is a config format; the hierarchy formats (yaml, json and toml) share the field names of the
+// yaml tags of Parameters
+type Format string
+
+const (
+	FormatYaml       Format = yamlType
+	FormatJson       Format = jsonType
+	FormatToml       Format = tomlType
+	FormatProperties Format = defConfigType
+)
+
+// parseDocument parses a hierarchy config into a yaml node; yaml and json are parsed directly (keeping
+// the positions of the elements), toml is decoded with the viper codec and then encoded as a yaml node. A
+// syntax error is a PositionError without its file
+func parseDocument(data []byte, typ string) (n *yaml.Node, err error) {
+	if fileTypeMapping[typ] != hierarchyType {
+		err = fmt.Errorf("%s is not a hierarchy config type", typ)
+		return
+	}
+	doc := &yaml.Node{}
+	if typ == tomlType {
+		var m map[string]any
+		if m, err = decodeMap(data, typ); err == nil {
+			err = doc.Encode(m)
+			doc = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{doc}}
+		}
+	} else {
+		err = yaml.Unmarshal(data, doc)
+	}
+	if err != nil {
+		err = syntaxError(err)
+		return
+	}
+	if len(doc.Content) > 0 {
+		n = doc.Content[0]
+	} else {
+		n = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+	if n.Kind != yaml.MappingNode {
+		err = fmt.Errorf("top-level element must be a map")
+		return
+	}
+	n, err = resolveAliases(n)
+	return
+}
+
+// Encode encodes the parameters in a hierarchy format, using the field names of the yaml tags, so the
+// result can be read back in that format
+func (p *Parameters) Encode(format Format) (b []byte, err error) {
+	typ := string(format)
+	switch typ {
+	case yamlType:
+		return yaml.Marshal(p)
+	case jsonType, tomlType:
+	default:
+		err = fmt.Errorf("cannot encode parameters as %s", format)
+		return
+	}
+	// go through yaml, so custom yaml marshalling (e.g. of Port) applies to all formats
+	var data []byte
+	if data, err = yaml.Marshal(p); err != nil {
+		return
+	}
+	m := make(map[string]any)
+	if err = yaml.Unmarshal(data, &m); err != nil {
+		return
+	}
+	var enc viper.Encoder
+	if enc, err = codecRegistry.Encoder(typ); err == nil {
+		b, err = enc.Encode(m)
+	}
+	return
+}
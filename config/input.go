@@ -1,24 +1,160 @@
 package config
 
 import (
-	"gopkg.in/yaml.v3"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
+	"sync"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 )
 
-func ReadConfig() (p *Parameters, err error) {
+// ReadConfig reads the config from the config file (see discover), environment variables and the
+// command-line flags, which are defined in pflag.CommandLine
+func ReadConfig() (*Parameters, error) {
+	return load(pflag.CommandLine, &options{args: os.Args[1:]})
+}
+
+// LoadFromReader reads the config from r, in the given format (detected from the content if empty), and
+// from environment variables; command-line arguments are only parsed if given with WithArgs
+func LoadFromReader(r io.Reader, format Format, opts ...Option) (p *Parameters, err error) {
+	o := &options{typ: string(format)}
+	if o.data, err = io.ReadAll(r); err != nil {
+		return
+	}
+	if o.data == nil {
+		o.data = []byte{}
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return load(pflag.NewFlagSet(readerName, pflag.ContinueOnError), o)
+}
+
+// LoadFile reads the config from the file at path, in the format of its extension (detected from the
+// content if unknown), and from environment variables; see LoadFromReader
+func LoadFile(path string, opts ...Option) (p *Parameters, err error) {
+	var typ string
+	if typ, err = detectType(path, Empty, false); err != nil {
+		return
+	}
+	var f *os.File
+	if f, err = os.Open(path); err != nil {
+		return
+	}
+	defer func() { _ = f.Close() }()
+	return LoadFromReader(f, Format(typ), append([]Option{func(o *options) { o.name = path }}, opts...)...)
+}
+
+// Option is an option of LoadFromReader
+type Option func(*options)
+
+type options struct {
+	args []string
+	data []byte
+	// name is the name of data in errors, readerName if empty
+	name     string
+	typ      string
+	overlays []string
+	profile  string
+	strict   bool
+	noExpand bool
+	offline  bool
+	// secret maps Secret keys onto the paths of their files, see KubernetesSource
+	secret map[string]string
+}
+
+// WithArgs parses args as command-line flags
+func WithArgs(args ...string) Option {
+	return func(o *options) {
+		o.args = args
+	}
+}
+
+// WithOverlays deep-merges the given yaml, json or toml files, in order, on top of the config; relative
+// paths are resolved against the directory of the config file (config_dir for a reader)
+func WithOverlays(paths ...string) Option {
+	return func(o *options) {
+		o.overlays = append(o.overlays, paths...)
+	}
+}
+
+// WithProfile merges the given entry of the profiles map on top of the config
+func WithProfile(profile string) Option {
+	return func(o *options) {
+		o.profile = profile
+	}
+}
+
+// WithStrict rejects unknown fields in the config
+func WithStrict() Option {
+	return func(o *options) {
+		o.strict = true
+	}
+}
+
+// WithoutEnvExpansion disables the expansion of environment variables in the config
+func WithoutEnvExpansion() Option {
+	return func(o *options) {
+		o.noExpand = true
+	}
+}
+
+// WithOffline uses only the cached remote config (if any), so no network service is contacted
+func WithOffline() Option {
+	return func(o *options) {
+		o.offline = true
+	}
+}
+
+func (o *options) apply(fc *fileConfig) {
+	if o.data != nil {
+		fc.data = o.data
+		fc.resolved = readerName
+		if o.name != Empty {
+			fc.resolved = o.name
+			fc.dir = filepath.Dir(o.name)
+		}
+		fc.typ = o.typ
+		fc.typeSet = o.typ != Empty
+	}
+	fc.overlays = append(fc.overlays, o.overlays...)
+	if o.profile != Empty {
+		fc.profile = o.profile
+	}
+	fc.strict = fc.strict || o.strict
+	fc.noExpand = fc.noExpand || o.noExpand
+	if fc.remote != nil {
+		fc.remote.offline = o.offline
+	}
+}
+
+func load(fs *pflag.FlagSet, o *options) (p *Parameters, err error) {
 	pm := initParameterMap()
 	var fc *fileConfig
-	if fc, err = pm.populate(); err != nil {
+	if fc, err = pm.populate(fs, o); err != nil {
 		return
 	}
-	if fc.configType() == hierarchyType {
-		if p, err = readParams(fc.path()); err != nil {
+	var d *document
+	if fc.configType() == hierarchyType || fc.remote != nil {
+		if p, d, err = readParams(fc); err != nil {
 			return
 		}
 	}
-	p, err = merge(p, pm)
+	if p, err = merge(p, pm); err != nil {
+		err = d.fieldPosition(err)
+		return
+	}
+	p.Prometheus.detectFlavor(context.Background(), o.offline)
 	return
 }
 
@@ -30,25 +166,68 @@ const (
 	hierarchyType
 )
 
+const (
+	yamlType  = "yaml"
+	ymlType   = "yml"
+	jsonType  = "json"
+	tomlType  = "toml"
+	propsType = "props"
+)
+
 var fileTypeMapping = map[string]configFileType{
-	"yaml":       hierarchyType,
-	"yml":        hierarchyType,
-	"properties": mapType,
-	"props":      mapType,
+	yamlType:      hierarchyType,
+	ymlType:       hierarchyType,
+	jsonType:      hierarchyType,
+	tomlType:      hierarchyType,
+	defConfigType: mapType,
+	propsType:     mapType,
 }
 
+// searchTypes is the order in which config file types are looked for in a directory - properties first, as
+// it has always been read; in mixed mode (mixedSearchTypes) hierarchy types first, so the properties config
+// file is layered on top of the yaml one rather than replacing it
+var (
+	searchTypes      = []string{defConfigType, propsType, yamlType, ymlType, jsonType, tomlType}
+	mixedSearchTypes = []string{yamlType, ymlType, jsonType, tomlType, defConfigType, propsType}
+)
+
+const (
+	// ConfigEnv is the environment variable holding the path of the config file or its parent directory
+	ConfigEnv = "DENSIFY_CONFIG"
+	// Stdin as the config file path means reading the config from the standard input
+	Stdin      = "-"
+	etcDir     = "/etc/densify/"
+	readerName = "<reader>"
+)
+
 type fileConfig struct {
-	dir  string
-	file string
-	typ  string
+	dir        string
+	file       string
+	typ        string
+	overlays   []string
+	profile    string
+	noExpand   bool
+	allowMixed bool
+	strict     bool
+	// explicit is the config file or directory given by flag (or its environment variable)
+	explicit string
+	// resolved is the path of the discovered config file, empty if none was found
+	resolved string
+	// typeSet indicates the config type was given explicitly
+	typeSet bool
+	// data is the content of the config if it is not read from a file (standard input or a reader)
+	data []byte
+	// remote is the remote config the local config is merged on top of, nil if none
+	remote *remoteConfig
 }
 
 func (fc *fileConfig) configType() (cft configFileType) {
 	var f bool
 	if fc != nil {
 		if cft, f = fileTypeMapping[fc.typ]; !f {
-			ext := filepath.Ext(fc.file)
-			cft, f = fileTypeMapping[ext[1:]]
+			if ext := filepath.Ext(fc.file); ext != Empty {
+				cft, f = fileTypeMapping[strings.ToLower(ext[1:])]
+			}
 		}
 	}
 	if !f {
@@ -58,21 +237,236 @@ func (fc *fileConfig) configType() (cft configFileType) {
 }
 
 func (fc *fileConfig) path() string {
-	file := fc.file
-	if ext := filepath.Ext(file); ext == Empty && fc.typ != Empty {
-		file = strings.Join([]string{file, fc.typ}, Dot)
+	return fc.resolved
+}
+
+// propertiesPath is the path of the properties config file next to the (yaml) config file
+func (fc *fileConfig) propertiesPath() string {
+	file := strings.TrimSuffix(filepath.Base(fc.resolved), filepath.Ext(fc.resolved))
+	return filepath.Join(filepath.Dir(fc.resolved), strings.Join([]string{file, defConfigType}, Dot))
+}
+
+// discover looks for the config file in order: the explicit flag, $DENSIFY_CONFIG, /etc/densify/ and the
+// config directory (./config by default). Each of these may be either a file or a directory, in which case
+// the config file name is looked for with each known extension, and then without any extension.
+// Not finding a config file is an error only if a location or a hierarchy type was given explicitly -
+// otherwise the config is expected to come from environment variables and flags
+func (fc *fileConfig) discover() (err error) {
+	if fc.data == nil && fc.explicit == Stdin {
+		if fc.data, err = io.ReadAll(os.Stdin); err != nil {
+			return
+		}
+		fc.resolved = Stdin
+	}
+	if fc.data != nil {
+		if !fc.typeSet {
+			fc.typ = sniffType(fc.data)
+		} else if _, f := fileTypeMapping[fc.typ]; !f {
+			err = fmt.Errorf("unknown config type %s", fc.typ)
+		}
+		return
 	}
-	return filepath.Join(fc.dir, file)
+	locations := []string{fc.explicit, os.Getenv(ConfigEnv), etcDir, fc.dir}
+	var tried []string
+	for i, location := range locations {
+		if location == Empty || slices.Contains(locations[:i], location) {
+			continue
+		}
+		var found bool
+		if tried, found = fc.search(location, tried); found {
+			fc.typ, err = detectType(fc.resolved, fc.typ, fc.typeSet)
+			fc.file = filepath.Base(fc.resolved)
+			fc.dir = filepath.Dir(fc.resolved)
+			return
+		}
+	}
+	if fc.explicit != Empty || os.Getenv(ConfigEnv) != Empty || fc.configType() == hierarchyType {
+		err = fmt.Errorf("config file not found, tried: %s", strings.Join(tried, ", "))
+	}
+	return
+}
+
+func (fc *fileConfig) search(location string, tried []string) ([]string, bool) {
+	fi, err := os.Stat(location)
+	if err != nil {
+		return append(tried, location), false
+	}
+	if !fi.IsDir() {
+		fc.resolved = location
+		return tried, true
+	}
+	types := searchTypes
+	switch {
+	case fc.typeSet:
+		types = []string{fc.typ}
+	case fc.allowMixed:
+		types = mixedSearchTypes
+	}
+	base := strings.TrimSuffix(fc.file, filepath.Ext(fc.file))
+	candidates := make([]string, 0, len(types)+1)
+	if filepath.Ext(fc.file) != Empty {
+		candidates = append(candidates, filepath.Join(location, fc.file))
+	}
+	for _, typ := range types {
+		candidates = append(candidates, filepath.Join(location, strings.Join([]string{base, typ}, Dot)))
+	}
+	candidates = append(candidates, filepath.Join(location, base))
+	for i, candidate := range candidates {
+		tried = append(tried, candidate)
+		if fi, err = os.Stat(candidate); err == nil && !fi.IsDir() {
+			fc.resolved = candidate
+			if !fc.allowMixed {
+				warnIgnored(candidate, candidates[i+1:])
+			}
+			return tried, true
+		}
+	}
+	return tried, false
+}
+
+// warnIgnored logs a warning for each of candidates which exists and is of another config file type than
+// the config file found, as the choice between them is then made by the search order alone
+func warnIgnored(found string, candidates []string) {
+	cft := fileTypeMapping[strings.TrimPrefix(filepath.Ext(found), Dot)]
+	for _, candidate := range candidates {
+		other, f := fileTypeMapping[strings.TrimPrefix(filepath.Ext(candidate), Dot)]
+		if !f || other == cft {
+			continue
+		}
+		if fi, err := os.Stat(candidate); err == nil && !fi.IsDir() {
+			slog.Warn("config file ignored, as another config file type is preferred", "config", found, "ignored", candidate)
+		}
+	}
+}
+
+// detectType returns the type of the config file at path - from its extension, the explicit type or the
+// content, in that order
+func detectType(path, typ string, typeSet bool) (string, error) {
+	if ext := strings.ToLower(filepath.Ext(path)); ext != Empty {
+		if _, f := fileTypeMapping[ext[1:]]; f {
+			return ext[1:], nil
+		}
+	}
+	if typeSet {
+		if _, f := fileTypeMapping[typ]; f {
+			return typ, nil
+		}
+		return Empty, fmt.Errorf("unknown config type %s", typ)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Empty, err
+	}
+	return sniffType(data), nil
+}
+
+// topLevelKeys are the yaml keys of Parameters, used to tell a hierarchy config from a properties one
+var topLevelKeys = []string{"forwarder", "prometheus", "collection", "clusters", "debug"}
+
+func sniffType(data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		return jsonType
+	}
+	// a properties file using "key: value" lines is valid yaml too
+	if isProperties(trimmed) {
+		return defConfigType
+	}
+	for _, typ := range []string{yamlType, tomlType} {
+		if m, err := decodeMap(trimmed, typ); err == nil {
+			for _, key := range topLevelKeys {
+				if _, f := m[key]; f {
+					return typ
+				}
+			}
+		}
+	}
+	return defConfigType
+}
+
+// propertiesKeys are the keys of a properties config file
+var propertiesKeys = sync.OnceValue(func() map[string]bool { return initParameterMap().keys })
+
+// isProperties indicates whether data parses as a properties file of known keys only
+func isProperties(data []byte) bool {
+	m, err := decodeMap(data, defConfigType)
+	if err != nil || len(m) == 0 {
+		return false
+	}
+	keys := propertiesKeys()
+	for key := range m {
+		if !keys[strings.ToLower(key)] {
+			return false
+		}
+	}
+	return true
 }
 
-func readParams(config string) (p *Parameters, err error) {
-	var data []byte
-	if data, err = os.ReadFile(config); err != nil {
+func decodeMap(data []byte, typ string) (m map[string]any, err error) {
+	m = make(map[string]any)
+	if typ == yamlType {
+		err = yaml.Unmarshal(data, &m)
 		return
 	}
+	var dec viper.Decoder
+	if dec, err = codecRegistry.Decoder(typ); err == nil {
+		err = dec.Decode(data, m)
+	}
+	return
+}
+
+// readParams reads the parameters of the hierarchy config and of the remote config, along with the document
+// they are decoded from
+func readParams(fc *fileConfig) (p *Parameters, d *document, err error) {
+	var n *yaml.Node
+	switch {
+	case fc.configType() != hierarchyType:
+		// remote config only
+		n = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	case fc.data != nil:
+		if n, err = parseDocument(fc.data, fc.typ); err != nil {
+			err = inFile(fc.path(), err)
+		}
+	default:
+		n, err = readDocument(fc.path(), fc.typ)
+	}
+	if err != nil {
+		return
+	}
+	d = newDocument(n, fc.path())
+	if fc.remote != nil {
+		var body []byte
+		if body, err = fc.remote.fetch(context.Background()); err != nil {
+			return
+		}
+		var r *yaml.Node
+		if r, err = parseDocument(body, yamlType); err != nil {
+			err = inFile(fc.remote.url, err)
+			return
+		}
+		d.add(r, fc.remote.url)
+		// environment variables must not leak into a remote config which is not verified
+		if !fc.noExpand && !fc.remote.integrityChecked() && escapeExpansion(r) {
+			slog.Warn("environment variables are not expanded in a remote config without a checksum or signature", "url", fc.remote.url)
+		}
+		d.root = mergeNodes(r, d.root)
+	}
+	if err = mergeDocuments(d, fc.path(), fc.dir, fc.overlays, fc.profile); err != nil {
+		return
+	}
+	if !fc.noExpand {
+		if err = expandEnv(d); err != nil {
+			return
+		}
+	}
+	if fc.strict {
+		if err = checkKnownFields(d, reflect.TypeFor[Parameters]()); err != nil {
+			return
+		}
+	}
 	p = &Parameters{}
-	if err = yaml.Unmarshal(data, p); err != nil {
-		p = nil
+	if err = d.root.Decode(p); err != nil {
+		p, err = nil, d.decodeError(err)
 	}
 	return
 }
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestDiscover(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  []string
+		mixed  bool
+		want   string
+		warned bool
+	}{
+		{name: "properties", files: []string{"config.properties"}, want: "config.properties"},
+		{name: "yaml", files: []string{"config.yaml"}, want: "config.yaml"},
+		{name: "both prefer properties", files: []string{"config.yaml", "config.properties"}, want: "config.properties", warned: true},
+		{name: "both in mixed mode", files: []string{"config.yaml", "config.properties"}, mixed: true, want: "config.yaml"},
+		{name: "no extension", files: []string{"config"}, want: "config"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			dir := t.TempDir()
+			for _, name := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			fc := &fileConfig{dir: dir, file: defConfigFile, typ: defConfigType, allowMixed: tt.mixed}
+			if err := fc.discover(); err != nil {
+				t.Fatal(err)
+			}
+			if got := filepath.Base(fc.path()); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+			if warned := strings.Contains(logs.String(), "config file ignored"); warned != tt.warned {
+				t.Errorf("warning logged: %t, want %t", warned, tt.warned)
+			}
+		})
+	}
+}
+
+func TestConfigEnv(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "collector.properties")
+	if err := os.WriteFile(path, []byte(baseProperties+"history=7\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// the generic CONFIG variable is not the config path
+	t.Setenv("CONFIG", filepath.Join(dir, "missing"))
+	t.Setenv(ConfigEnv, path)
+	p, err := loadDir(t, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Collection.History != 7 {
+		t.Errorf("got history %d, want 7", p.Collection.History)
+	}
+}
+
+func TestSniffType(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "json", data: ` {"prometheus": {"url": {"host": "prom"}}}`, want: jsonType},
+		{name: "yaml", data: "prometheus:\n  url:\n    host: prom\n", want: yamlType},
+		{name: "yaml debug only", data: "debug: true\nclusters:\n  - name: c0\n", want: yamlType},
+		{name: "toml", data: "[prometheus.url]\nhost = \"prom\"\n", want: tomlType},
+		{name: "properties", data: baseProperties, want: defConfigType},
+		{name: "properties with colons", data: "prometheus_address: prom\ndebug: true\n", want: defConfigType},
+		{name: "properties with a comment", data: "# debug: true\nhistory: 3\n", want: defConfigType},
+		{name: "unknown", data: "something: else\n", want: defConfigType},
+		{name: "empty", want: defConfigType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sniffType([]byte(tt.data)); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadFormats(t *testing.T) {
+	files := map[string]string{
+		"config.yaml":       "prometheus:\n  url:\n    host: prom\ncollection:\n  history: 3\nclusters:\n  - name: c0\n",
+		"config.json":       `{"prometheus": {"url": {"host": "prom"}}, "collection": {"history": 3}, "clusters": [{"name": "c0"}]}`,
+		"config.toml":       "[prometheus.url]\nhost = \"prom\"\n[collection]\nhistory = 3\n[[clusters]]\nname = \"c0\"\n",
+		"sniffed-json":      `{"prometheus": {"url": {"host": "prom"}}, "collection": {"history": 3}, "clusters": [{"name": "c0"}]}`,
+		"sniffed-toml":      "[prometheus.url]\nhost = \"prom\"\n[collection]\nhistory = 3\n[[clusters]]\nname = \"c0\"\n",
+		"sniffed-yaml":      "prometheus:\n  url:\n    host: prom\ncollection:\n  history: 3\nclusters:\n  - name: c0\n",
+		"sniffed-colons":    "prometheus_address: prom\nhistory: 3\ncluster_name: c0\ndebug: false\n",
+		"config.properties": "prometheus_address=prom\nhistory=3\ncluster_name=c0\n",
+	}
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name := range files {
+		t.Run(name, func(t *testing.T) {
+			p, err := LoadFile(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Prometheus.UrlConfig.Host != "prom" || p.Collection.History != 3 || len(p.Clusters) != 1 || p.Clusters[0].Name != "c0" {
+				t.Errorf("got host %s, history %d, clusters %d", p.Prometheus.UrlConfig.Host, p.Collection.History, len(p.Clusters))
+			}
+		})
+	}
+}
+
+func TestStrict(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "config.yaml", data: "prometheus:\n  url:\n    host: prom\n    hots: x\n", want: "config.yaml:4: prometheus.url.hots: unknown field"},
+		{name: "config.json", data: `{"prometheus": {"url": {"host": "prom"}}, "colection": {}}`, want: "colection: unknown field"},
+		{name: "config.toml", data: "bogus = 1\n[prometheus.url]\nhost = \"prom\"\n", want: "bogus: unknown field"},
+		{name: "clusters.yaml", data: "prometheus:\n  url:\n    host: prom\nclusters:\n  - name: c0\n    collection:\n      histroy: 1\n", want: "clusters[0].collection.histroy: unknown field"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.name)
+			if err := os.WriteFile(path, []byte(tt.data), 0600); err != nil {
+				t.Fatal(err)
+			}
+			// unknown fields are ignored unless strict
+			if _, err := LoadFile(path); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadFile(path, WithStrict())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+			if _, err = LoadFile(path, WithArgs("--"+configStrict)); err == nil {
+				t.Error("expected an error with the strict flag")
+			}
+		})
+	}
+}
+
+func TestLoadFromReader(t *testing.T) {
+	const colons = "prometheus_address: prom\nhistory: 3\n"
+	tests := []struct {
+		name   string
+		data   string
+		format Format
+		args   []string
+		host   string
+		err    string
+	}{
+		{name: "sniffed yaml", data: "prometheus:\n  url:\n    host: prom\n", host: "prom"},
+		{name: "sniffed properties", data: colons, host: "prom"},
+		{name: "explicit properties", data: colons, format: FormatProperties, host: "prom"},
+		// the properties keys are unknown yaml fields
+		{name: "explicit yaml", data: colons, format: FormatYaml, args: []string{"--" + promHost + "=flag-prom"}, host: "flag-prom"},
+		{name: "explicit yaml strict", data: colons, format: FormatYaml, args: []string{"--" + configStrict}, err: "<reader>:1: prometheus_address: unknown field"},
+		{name: "explicit json", data: `{"prometheus": {"url": {"host": "prom"}}}`, format: FormatJson, host: "prom"},
+		{name: "unknown format", data: colons, format: "xml", err: "unknown config type xml"},
+		{name: "empty body", args: []string{"--" + promHost + "=flag-prom"}, host: "flag-prom"},
+		{name: "empty yaml body", format: FormatYaml, args: []string{"--" + promHost + "=flag-prom"}, host: "flag-prom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := LoadFromReader(strings.NewReader(tt.data), tt.format, WithArgs(tt.args...))
+			if tt.err != Empty {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Prometheus.UrlConfig.Host != tt.host {
+				t.Errorf("got host %s, want %s", p.Prometheus.UrlConfig.Host, tt.host)
+			}
+		})
+	}
+}
+
+func TestLoadStdin(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		args []string
+	}{
+		{name: "sniffed yaml", data: "prometheus:\n  url:\n    host: prom\ncollection:\n  history: 3\n"},
+		{name: "properties", data: "prometheus_address=prom\nhistory=3\n", args: []string{"--" + configType + "=properties"}},
+		{name: "explicit toml", data: "[prometheus.url]\nhost = \"prom\"\n[collection]\nhistory = 3\n", args: []string{"--" + configType + "=toml"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "stdin")
+			if err := os.WriteFile(path, []byte(tt.data), 0600); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = f.Close() }()
+			stdin := os.Stdin
+			os.Stdin = f
+			defer func() { os.Stdin = stdin }()
+			fs := pflag.NewFlagSet(t.Name(), pflag.ContinueOnError)
+			p, err := load(fs, &options{args: append([]string{"--" + config, Stdin}, tt.args...)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Prometheus.UrlConfig.Host != "prom" || p.Collection.History != 3 {
+				t.Errorf("got host %s, history %d", p.Prometheus.UrlConfig.Host, p.Collection.History)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// k8sDataDir is the symlink to the current timestamped directory of a projected volume; kubelet
+	// updates the volume by atomically swapping it
+	k8sDataDir       = "..data"
+	defK8sConfigFile = "config.yaml"
+	defK8sPoll       = 10 * time.Second
+)
+
+// Secret keys, mapped onto fields by convention; the fields are set to the paths of the mounted files (all of
+// these fields accept either a value or a file name), so a rotated Secret is picked up by whoever reads the file
+const (
+	secretUsername           = "username"
+	secretPassword           = "password"
+	secretEncryptedPassword  = "encrypted_password"
+	secretDensifyToken       = "densify.token"
+	secretToken              = "token"
+	secretCaCert             = "ca.crt"
+	secretPrometheusUsername = "prometheus.username"
+	secretPrometheusPassword = "prometheus.password"
+	secretProxyUsername      = "proxy.username"
+	secretProxyPassword      = "proxy.password"
+)
+
+var secretKeys = []string{secretUsername, secretPassword, secretEncryptedPassword, secretDensifyToken, secretToken,
+	secretCaCert, secretPrometheusUsername, secretPrometheusPassword, secretProxyUsername, secretProxyPassword}
+
+// KubernetesSource reads the config from a ConfigMap and a Secret mounted as (projected) volumes:
+//   - ConfigMapDir is the mount path of the ConfigMap, which holds ConfigFile (config.yaml by default)
+//   - SecretDir is the optional mount path of the Secret, whose keys are mapped onto fields by convention
+//     (see secretKeys and applySecret); the Secret has the lowest precedence, it only sets the fields set by
+//     neither the config, environment variables nor flags
+type KubernetesSource struct {
+	ConfigMapDir string
+	SecretDir    string
+	ConfigFile   string
+}
+
+func (ks *KubernetesSource) configFile() string {
+	if ks.ConfigFile != Empty {
+		return ks.ConfigFile
+	}
+	return defK8sConfigFile
+}
+
+// Load reads the config through the LoadFromReader pipeline
+func (ks *KubernetesSource) Load(opts ...Option) (p *Parameters, err error) {
+	path := filepath.Join(ks.ConfigMapDir, ks.configFile())
+	var data []byte
+	if data, err = os.ReadFile(path); err != nil {
+		return
+	}
+	var typ string
+	if typ, err = detectType(path, Empty, false); err != nil {
+		return
+	}
+	var secret map[string]string
+	if secret, err = ks.secret(); err != nil {
+		return
+	}
+	opts = append(opts, func(o *options) {
+		o.secret = secret
+	})
+	return LoadFromReader(bytes.NewReader(data), Format(typ), opts...)
+}
+
+// secret returns the paths of the files of the known Secret keys, by key
+func (ks *KubernetesSource) secret() (secret map[string]string, err error) {
+	if ks.SecretDir == Empty {
+		return
+	}
+	var keys []string
+	if keys, err = projectedKeys(ks.SecretDir); err != nil {
+		return
+	}
+	secret = make(map[string]string)
+	for _, key := range keys {
+		if slices.Contains(secretKeys, key) {
+			secret[key] = filepath.Join(ks.SecretDir, key)
+		}
+	}
+	return
+}
+
+// applySecret sets the fields left empty by the config, environment variables and flags to the Secret
+// values; the densify credentials go to the configured auth of each densify instance - the densify section,
+// or each densify destination
+func (p *Parameters) applySecret(secret map[string]string) {
+	if len(secret) == 0 {
+		return
+	}
+	setDefault(&p.Prometheus.BearerToken, secret[secretToken])
+	setDefault(&p.Prometheus.CaCertPath, secret[secretCaCert])
+	setDefault(&p.Prometheus.UrlConfig.Username, secret[secretPrometheusUsername])
+	setDefault(&p.Prometheus.UrlConfig.Password, secret[secretPrometheusPassword])
+	setDefault(&p.Forwarder.Proxy.UrlConfig.Username, secret[secretProxyUsername])
+	setDefault(&p.Forwarder.Proxy.UrlConfig.Password, secret[secretProxyPassword])
+	if len(p.Forwarder.Destinations) == 0 {
+		p.Forwarder.Densify.applySecret(secret)
+		return
+	}
+	for _, d := range p.Forwarder.Destinations {
+		if d != nil && d.Densify != nil {
+			d.Densify.applySecret(secret)
+		}
+	}
+}
+
+// applySecret sets the credentials of the auth section (of its type, if it has no section yet) or, if there
+// is no auth section, of the url
+func (dp *DensifyParameters) applySecret(secret map[string]string) {
+	var typ string
+	if dp.Auth != nil {
+		// an auth section without a section of its type yet, e.g. type: basic, gets one
+		if typ, _ = dp.Auth.typ(); typ == Empty {
+			if typ = strings.ToLower(dp.Auth.Type); typ == Empty {
+				return
+			}
+		}
+	}
+	var user, password, encPassword *string
+	switch typ {
+	case Empty:
+		if dp.UrlConfig == nil {
+			dp.UrlConfig = &UrlConfig{}
+		}
+		user, password, encPassword = &dp.UrlConfig.Username, &dp.UrlConfig.Password, &dp.UrlConfig.EncryptedPassword
+	case AuthBasic:
+		if dp.Auth.Basic == nil {
+			dp.Auth.Basic = &BasicAuth{}
+		}
+		user, password, encPassword = &dp.Auth.Basic.Username, &dp.Auth.Basic.Password, &dp.Auth.Basic.EncryptedPassword
+	case AuthToken:
+		if dp.Auth.Token == nil {
+			dp.Auth.Token = &TokenAuth{}
+		}
+		setDefault(&dp.Auth.Token.Token, secret[secretDensifyToken])
+		return
+	default:
+		return
+	}
+	setDefault(user, secret[secretUsername])
+	// a password is either plain or encrypted, the plain one first
+	if *password == Empty && *encPassword == Empty {
+		if setDefault(password, secret[secretPassword]); *password == Empty {
+			setDefault(encPassword, secret[secretEncryptedPassword])
+		}
+	}
+}
+
+func setDefault(target *string, value string) {
+	if *target == Empty {
+		*target = value
+	}
+}
+
+// projectedKeys returns the keys of a mounted ConfigMap or Secret; the entries of a projected volume are
+// listed in its ..data directory, so the timestamped directories and symlinks are skipped
+func projectedKeys(dir string) (keys []string, err error) {
+	listDir := filepath.Join(dir, k8sDataDir)
+	if _, e := os.Stat(listDir); e != nil {
+		listDir = dir
+	}
+	var entries []os.DirEntry
+	if entries, err = os.ReadDir(listDir); err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), Dot) {
+			keys = append(keys, entry.Name())
+		}
+	}
+	return
+}
+
+// volumeVersion identifies the current content of a mounted volume - the target of ..data for a projected volume,
+// or the latest modification time of its entries otherwise
+func volumeVersion(dir string) string {
+	if dir == Empty {
+		return Empty
+	}
+	if target, err := os.Readlink(filepath.Join(dir, k8sDataDir)); err == nil {
+		return target
+	}
+	var latest time.Time
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, entry := range entries {
+			if fi, e := entry.Info(); e == nil && fi.ModTime().After(latest) {
+				latest = fi.ModTime()
+			}
+		}
+	}
+	return latest.String()
+}
+
+func (ks *KubernetesSource) version() string {
+	return volumeVersion(ks.ConfigMapDir) + "|" + volumeVersion(ks.SecretDir)
+}
+
+// Watch polls the mounted volumes every interval (10s if not positive) until ctx is done, and calls onChange
+// with the reloaded config whenever kubelet swaps the content of either of them
+func (ks *KubernetesSource) Watch(ctx context.Context, interval time.Duration, onChange func(*Parameters, error), opts ...Option) {
+	if interval <= 0 {
+		interval = defK8sPoll
+	}
+	current := ks.version()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if v := ks.version(); v != current {
+				current = v
+				onChange(ks.Load(opts...))
+			}
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const k8sConfig = `prometheus:
+  url:
+    host: prom
+forwarder:
+  proxy:
+    url:
+      scheme: http
+      host: proxy
+`
+
+// projectedVolume writes files to dir as kubelet lays out a projected volume - in a timestamped directory
+// the ..data symlink points to, which is atomically swapped on update
+func projectedVolume(t *testing.T, dir, version string, files map[string]string) {
+	t.Helper()
+	versionDir := filepath.Join(dir, ".."+version)
+	if err := os.MkdirAll(versionDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(versionDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		link := filepath.Join(dir, name)
+		if _, err := os.Lstat(link); os.IsNotExist(err) {
+			if err = os.Symlink(filepath.Join(k8sDataDir, name), link); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	tmp := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(".."+version, tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, k8sDataDir)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// kubernetesSource returns a source of the given ConfigMap config.yaml and Secret keys (none if nil)
+func kubernetesSource(t *testing.T, config string, secret []string) *KubernetesSource {
+	t.Helper()
+	ks := &KubernetesSource{ConfigMapDir: t.TempDir()}
+	projectedVolume(t, ks.ConfigMapDir, "v1", map[string]string{defK8sConfigFile: config})
+	if secret != nil {
+		ks.SecretDir = t.TempDir()
+		files := make(map[string]string, len(secret))
+		for _, key := range secret {
+			files[key] = "secret-" + key
+		}
+		projectedVolume(t, ks.SecretDir, "v1", files)
+	}
+	return ks
+}
+
+func TestKubernetesLoad(t *testing.T) {
+	ks := kubernetesSource(t, k8sConfig, secretKeys)
+	p, err := ks.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := func(key string) string { return filepath.Join(ks.SecretDir, key) }
+	got := map[string]string{
+		secretUsername:           p.Forwarder.Densify.UrlConfig.Username,
+		secretPassword:           p.Forwarder.Densify.UrlConfig.Password,
+		secretEncryptedPassword:  p.Forwarder.Densify.UrlConfig.EncryptedPassword,
+		secretToken:              p.Prometheus.BearerToken,
+		secretCaCert:             p.Prometheus.CaCertPath,
+		secretPrometheusUsername: p.Prometheus.UrlConfig.Username,
+		secretPrometheusPassword: p.Prometheus.UrlConfig.Password,
+		secretProxyUsername:      p.Forwarder.Proxy.UrlConfig.Username,
+		secretProxyPassword:      p.Forwarder.Proxy.UrlConfig.Password,
+	}
+	for key, value := range got {
+		// a password is either plain or encrypted, the plain one is set first
+		if want := secret(key); key != secretEncryptedPassword && value != want {
+			t.Errorf("%s: got %s, want %s", key, value, want)
+		}
+	}
+	if got[secretEncryptedPassword] != Empty {
+		t.Errorf("got both a password and an encrypted password")
+	}
+	// no Secret
+	if p, err = kubernetesSource(t, k8sConfig, nil).Load(); err != nil || p.Forwarder.Densify.UrlConfig.Username != Empty {
+		t.Errorf("got %v, %v", p, err)
+	}
+}
+
+func TestKubernetesSecretPrecedence(t *testing.T) {
+	credentials := []string{secretUsername, secretPassword, secretDensifyToken}
+	tests := []struct {
+		name   string
+		config string
+		env    map[string]string
+		args   []string
+		check  func(p *Parameters, secret func(string) string) bool
+	}{
+		{name: "the Secret fills the url credentials",
+			check: func(p *Parameters, secret func(string) string) bool {
+				uc := p.Forwarder.Densify.UrlConfig
+				return uc.Username == secret(secretUsername) && uc.Password == secret(secretPassword) && p.Forwarder.Densify.Auth.Type == AuthBasic
+			}},
+		{name: "the config over the Secret", config: "  densify:\n    url:\n      username: fileuser\n",
+			check: func(p *Parameters, secret func(string) string) bool {
+				uc := p.Forwarder.Densify.UrlConfig
+				return uc.Username == "fileuser" && uc.Password == secret(secretPassword)
+			}},
+		{name: "environment over the Secret", env: map[string]string{"DENSIFY_USER": "envuser"},
+			check: func(p *Parameters, secret func(string) string) bool {
+				return p.Forwarder.Densify.UrlConfig.Username == "envuser"
+			}},
+		{name: "flags over the Secret", args: []string{"--" + densifyUser + "=flaguser", "--" + setFlag, "prometheus.bearer_token=settoken"},
+			check: func(p *Parameters, secret func(string) string) bool {
+				return p.Forwarder.Densify.UrlConfig.Username == "flaguser" && p.Prometheus.BearerToken == "settoken"
+			}},
+		{name: "overrides over the Secret", env: map[string]string{"DENSIFY_CC_FORWARDER_DENSIFY_URL_USERNAME": "ccuser"},
+			check: func(p *Parameters, secret func(string) string) bool {
+				return p.Forwarder.Densify.UrlConfig.Username == "ccuser"
+			}},
+		{name: "basic auth", config: "  densify:\n    auth:\n      type: basic\n",
+			check: func(p *Parameters, secret func(string) string) bool {
+				b := p.Forwarder.Densify.Auth.Basic
+				return b.Username == secret(secretUsername) && b.Password == secret(secretPassword)
+			}},
+		{name: "token auth", config: "  densify:\n    auth:\n      type: token\n",
+			check: func(p *Parameters, secret func(string) string) bool {
+				da := p.Forwarder.Densify.Auth
+				return da.Type == AuthToken && da.Token.Token == secret(secretDensifyToken) && p.Forwarder.Densify.UrlConfig.Username == Empty
+			}},
+		{name: "token auth with its token", config: "  densify:\n    auth:\n      token:\n        token: filetoken\n",
+			check: func(p *Parameters, secret func(string) string) bool {
+				return p.Forwarder.Densify.Auth.Token.Token == "filetoken"
+			}},
+		{name: "destinations", config: "  destinations:\n    - name: d0\n      densify:\n        url:\n          host: d0.densify.com\n    - name: d1\n      densify:\n        url:\n          host: d1.densify.com\n        auth:\n          basic:\n            username: d1user\n            password: d1password\n",
+			check: func(p *Parameters, secret func(string) string) bool {
+				d0, d1 := p.Forwarder.Destinations[0].Densify, p.Forwarder.Destinations[1].Densify
+				return d0.UrlConfig.Username == secret(secretUsername) && d0.UrlConfig.Password == secret(secretPassword) &&
+					d1.Auth.Basic.Username == "d1user" && d1.Auth.Basic.Password == "d1password"
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			config := k8sConfig
+			if tt.config != Empty {
+				config += tt.config
+			}
+			ks := kubernetesSource(t, config, credentials)
+			p, err := ks.Load(WithArgs(tt.args...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(p, func(key string) string { return filepath.Join(ks.SecretDir, key) }) {
+				t.Errorf("unexpected parameters: %+v", p.Forwarder.Densify)
+			}
+		})
+	}
+}
+
+func TestKubernetesWatch(t *testing.T) {
+	ks := kubernetesSource(t, k8sConfig+"collection:\n  history: 1\n", []string{secretUsername})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	changes := make(chan *Parameters, 2)
+	done := make(chan struct{})
+	go func() {
+		ks.Watch(ctx, 10*time.Millisecond, func(p *Parameters, err error) {
+			if err != nil {
+				t.Error(err)
+			}
+			changes <- p
+		})
+		close(done)
+	}()
+	// no change without a swap
+	time.Sleep(50 * time.Millisecond)
+	if len(changes) > 0 {
+		t.Fatal("reloaded without a change")
+	}
+	projectedVolume(t, ks.ConfigMapDir, "v2", map[string]string{defK8sConfigFile: k8sConfig + "collection:\n  history: 2\n"})
+	select {
+	case p := <-changes:
+		if p.Collection.History != 2 || p.Forwarder.Densify.UrlConfig.Username != filepath.Join(ks.SecretDir, secretUsername) {
+			t.Errorf("got history %d, username %s", p.Collection.History, p.Forwarder.Densify.UrlConfig.Username)
+		}
+	case <-ctx.Done():
+		t.Fatal("no reload after the ConfigMap swap")
+	}
+	// a Secret swap reloads too
+	projectedVolume(t, ks.SecretDir, "v2", map[string]string{secretUsername: "rotated"})
+	select {
+	case <-changes:
+	case <-ctx.Done():
+		t.Fatal("no reload after the Secret swap")
+	}
+	cancel()
+	<-done
+}
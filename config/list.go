@@ -0,0 +1,62 @@
+package config
+
+import (
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StringList is a list of strings, unmarshalled from either a yaml sequence or a (legacy) comma-separated string
+type StringList []string
+
+func NewStringList(s string) (sl StringList) {
+	for _, elem := range strings.Split(s, Comma) {
+		if elem = strings.TrimSpace(elem); elem != Empty {
+			sl = append(sl, elem)
+		}
+	}
+	return
+}
+
+func (sl *StringList) UnmarshalYAML(node *yaml.Node) (err error) {
+	if node.Kind == yaml.SequenceNode {
+		var elems []string
+		if err = node.Decode(&elems); err == nil {
+			*sl = elems
+		}
+		return
+	}
+	var s string
+	if err = node.Decode(&s); err == nil {
+		*sl = NewStringList(s)
+	}
+	return
+}
+
+// String returns the legacy comma-separated form of the list
+func (sl StringList) String() string {
+	return strings.Join(sl, Comma)
+}
+
+// appendUnique appends the elements of other which are not already in sl, keeping the order
+func (sl StringList) appendUnique(other StringList) StringList {
+	seen := make(map[string]bool, len(sl)+len(other))
+	result := make(StringList, 0, len(sl)+len(other))
+	for _, elem := range slices.Concat(sl, other) {
+		if !seen[elem] {
+			seen[elem] = true
+			result = append(result, elem)
+		}
+	}
+	return result
+}
+
+// setListValue is setValue for lists given as comma-separated strings
+func setListValue(target *StringList, vals values[string], name string) {
+	if val, ok := vals[name]; ok {
+		if val.isSet || len(*target) == 0 {
+			*target = NewStringList(val.v)
+		}
+	}
+}
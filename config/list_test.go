@@ -0,0 +1,129 @@
+package config
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestNewStringList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want StringList
+	}{
+		{in: "a,b", want: StringList{"a", "b"}},
+		{in: " a , ,b ,", want: StringList{"a", "b"}},
+		{in: "a", want: StringList{"a"}},
+		{in: Empty},
+		{in: " , "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got := NewStringList(tt.in)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+			if got.String() != strings.Join(tt.want, Comma) {
+				t.Errorf("got string %q", got.String())
+			}
+		})
+	}
+}
+
+func TestStringListYaml(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want StringList
+		err  bool
+	}{
+		{name: "sequence", yaml: "l:\n  - a\n  - b\n", want: StringList{"a", "b"}},
+		{name: "flow sequence", yaml: "l: [a, b]\n", want: StringList{"a", "b"}},
+		{name: "empty sequence", yaml: "l: []\n", want: StringList{}},
+		{name: "comma-separated", yaml: "l: a, b\n", want: StringList{"a", "b"}},
+		{name: "single", yaml: "l: a\n", want: StringList{"a"}},
+		{name: "map", yaml: "l: {a: b}\n", err: true},
+		{name: "nested sequence", yaml: "l: [[a]]\n", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v struct {
+				L StringList `yaml:"l"`
+			}
+			err := yaml.Unmarshal([]byte(tt.yaml), &v)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want an error: %t", err, tt.err)
+			}
+			if !tt.err && !reflect.DeepEqual(v.L, tt.want) {
+				t.Errorf("got %#v, want %#v", v.L, tt.want)
+			}
+		})
+	}
+	// encoded as a sequence
+	b, err := yaml.Marshal(struct {
+		L StringList `yaml:"l"`
+	}{StringList{"a", "b"}})
+	if err != nil || string(b) != "l:\n    - a\n    - b\n" {
+		t.Errorf("got %q, %v", b, err)
+	}
+}
+
+func TestStringListLoad(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		env   map[string]string
+		args  []string
+		want  StringList
+	}{
+		{name: "properties", files: map[string]string{"config.properties": baseProperties + "role_list=a, b\n"}, want: StringList{"a", "b"}},
+		{name: "yaml sequence", files: map[string]string{"config.yaml": baseYaml + "collection:\n  role_list: [a, b]\n"}, want: StringList{"a", "b"}},
+		{name: "yaml string", files: map[string]string{"config.yaml": baseYaml + "collection:\n  role_list: a,b\n"}, want: StringList{"a", "b"}},
+		{name: "env", files: map[string]string{"config.yaml": baseYaml + "collection:\n  role_list: [x]\n"}, env: map[string]string{"ROLE_LIST": "a,b"}, want: StringList{"a", "b"}},
+		{name: "flag", args: []string{"--" + roleList + "=a,b"}, want: StringList{"a", "b"}},
+		{name: "override string", files: map[string]string{"config.yaml": baseYaml}, env: map[string]string{"DENSIFY_CC_COLLECTION_ROLE_LIST": "a,b"}, want: StringList{"a", "b"}},
+		{name: "override sequence", files: map[string]string{"config.yaml": baseYaml}, args: []string{"--" + setFlag, "collection.role_list=[a, b]"}, want: StringList{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			files := tt.files
+			if files == nil {
+				files = map[string]string{"config.properties": baseProperties}
+			}
+			p, err := loadDir(t, files, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(p.Collection.RoleList, tt.want) {
+				t.Errorf("got %#v, want %#v", p.Collection.RoleList, tt.want)
+			}
+			// read back in every hierarchy format
+			for _, format := range []Format{FormatYaml, FormatJson, FormatToml} {
+				b, err := p.Encode(format)
+				if err != nil {
+					t.Fatal(err)
+				}
+				q, err := LoadFromReader(bytes.NewReader(b), format)
+				if err != nil {
+					t.Fatalf("%s: %v:\n%s", format, err, b)
+				}
+				if !reflect.DeepEqual(q.Collection.RoleList, tt.want) {
+					t.Errorf("%s: got %#v back", format, q.Collection.RoleList)
+				}
+			}
+		})
+	}
+}
+
+func TestStringListAppendUnique(t *testing.T) {
+	got := StringList{"a", "b", "a"}.appendUnique(StringList{"c", "b"})
+	if want := (StringList{"a", "b", "c"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,199 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	profilesKey = "profiles"
+	nullTag     = "!!null"
+	mergeTag    = "!!merge"
+)
+
+// mergeDocuments deep-merges the ordered overlay files on top of the base document (read from base). If
+// profile is not empty, the matching entry of the "profiles" map of each document is merged right after that
+// document. The "profiles" map itself is never part of the result. Relative overlay paths are resolved
+// against dir. The overlays are added to the sources of d, whose root is replaced by the merged document
+func mergeDocuments(d *document, base, dir string, overlays []string, profile string) (err error) {
+	var found bool
+	var merged *yaml.Node
+	doc := d.root
+	for i, path := range append([]string{base}, overlays...) {
+		if i > 0 {
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			var typ string
+			if typ, err = detectType(path, Empty, false); err != nil {
+				return
+			}
+			if doc, err = readDocument(path, typ); err != nil {
+				return
+			}
+			d.add(doc, path)
+		}
+		var prof *yaml.Node
+		if doc, prof, err = extractProfile(doc, profile); err != nil {
+			err = inFile(path, err)
+			return
+		}
+		merged = mergeNodes(merged, doc)
+		if prof != nil {
+			found = true
+			merged = mergeNodes(merged, prof)
+		}
+	}
+	if profile != Empty && !found {
+		err = fmt.Errorf("profile %s not found", profile)
+	}
+	d.root = merged
+	return
+}
+
+func readDocument(path, typ string) (n *yaml.Node, err error) {
+	var data []byte
+	if data, err = os.ReadFile(path); err != nil {
+		return
+	}
+	if n, err = parseDocument(data, typ); err != nil {
+		err = inFile(path, err)
+	}
+	return
+}
+
+func extractProfile(doc *yaml.Node, profile string) (body, prof *yaml.Node, err error) {
+	body = doc
+	i := mappingIndex(doc, profilesKey)
+	if i < 0 {
+		return
+	}
+	profiles := doc.Content[i+1]
+	body = &yaml.Node{Kind: doc.Kind, Tag: doc.Tag, Line: doc.Line, Column: doc.Column}
+	body.Content = append(append(body.Content, doc.Content[:i]...), doc.Content[i+2:]...)
+	if profile == Empty {
+		return
+	}
+	if profiles.Kind != yaml.MappingNode {
+		err = fmt.Errorf("%s must be a map of profile name to configuration", profilesKey)
+		return
+	}
+	if j := mappingIndex(profiles, profile); j >= 0 {
+		prof = profiles.Content[j+1]
+	}
+	return
+}
+
+// mergeNodes applies src on top of dst following the precedence of setValue: a value set in src replaces
+// the dst one, whereas a null value in src (e.g. "key:") keeps it. Maps are merged recursively, lists and
+// scalars are replaced
+func mergeNodes(dst, src *yaml.Node) *yaml.Node {
+	if dst == nil || dst.Kind != yaml.MappingNode || src.Kind != yaml.MappingNode {
+		return src
+	}
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		k, v := src.Content[i], src.Content[i+1]
+		switch j := mappingIndex(dst, k.Value); {
+		case j < 0:
+			dst.Content = append(dst.Content, k, v)
+		case takesPrecedence(!isNull(v), isNull(dst.Content[j+1])):
+			dst.Content[j+1] = mergeNodes(dst.Content[j+1], v)
+		}
+	}
+	return dst
+}
+
+func isNull(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode && n.ShortTag() == nullTag
+}
+
+// resolveAliases returns a copy of n with its aliases replaced by copies of the anchored nodes and the
+// merge keys (<<) of its maps applied, so documents are merged key by key whatever their yaml shorthands.
+// The keys of a map take precedence over the merged ones, and a merged map over the ones listed after it.
+// An alias within its own anchored node is an error, as is a copy of more than maxResolvedNodes nodes
+// (e.g. a "billion laughs" document, which expands exponentially)
+func resolveAliases(n *yaml.Node) (*yaml.Node, error) {
+	ar := &aliasResolver{inProgress: make(map[*yaml.Node]bool)}
+	return ar.resolve(n)
+}
+
+// maxResolvedNodes bounds the number of nodes of a document with its aliases resolved
+const maxResolvedNodes = 100000
+
+// aliasResolver holds the anchored nodes being resolved and the number of nodes resolved so far
+type aliasResolver struct {
+	inProgress map[*yaml.Node]bool
+	nodes      int
+}
+
+func (ar *aliasResolver) resolve(n *yaml.Node) (r *yaml.Node, err error) {
+	if n.Kind == yaml.AliasNode {
+		if ar.inProgress[n.Alias] {
+			return nil, atLine(n.Line, fmt.Errorf("alias *%s is within its own anchored value", n.Value))
+		}
+		return ar.resolve(n.Alias)
+	}
+	if ar.nodes++; ar.nodes > maxResolvedNodes {
+		return nil, atLine(n.Line, fmt.Errorf("the document has more than %d nodes with its aliases resolved", maxResolvedNodes))
+	}
+	ar.inProgress[n] = true
+	defer delete(ar.inProgress, n)
+	c := *n
+	c.Anchor, c.Content = Empty, nil
+	var merged []*yaml.Node
+	for i := 0; i < len(n.Content); i++ {
+		if n.Kind == yaml.MappingNode && i%2 == 0 && n.Content[i].ShortTag() == mergeTag && i+1 < len(n.Content) {
+			i++
+			if merged, err = ar.appendMerged(merged, n.Content[i]); err != nil {
+				return
+			}
+			continue
+		}
+		var rc *yaml.Node
+		if rc, err = ar.resolve(n.Content[i]); err != nil {
+			return
+		}
+		c.Content = append(c.Content, rc)
+	}
+	for _, m := range merged {
+		for j := 0; j+1 < len(m.Content); j += 2 {
+			if mappingIndex(&c, m.Content[j].Value) < 0 {
+				c.Content = append(c.Content, m.Content[j], m.Content[j+1])
+			}
+		}
+	}
+	return &c, nil
+}
+
+// appendMerged appends the value of a merge key, a map or a list of maps, to merged
+func (ar *aliasResolver) appendMerged(merged []*yaml.Node, v *yaml.Node) ([]*yaml.Node, error) {
+	rv, err := ar.resolve(v)
+	if err != nil {
+		return nil, err
+	}
+	elems := []*yaml.Node{rv}
+	if rv.Kind == yaml.SequenceNode {
+		elems = rv.Content
+	}
+	for _, e := range elems {
+		if e.Kind != yaml.MappingNode {
+			return nil, atLine(v.Line, errors.New("the value of a merge key must be a map or a list of maps"))
+		}
+	}
+	return append(merged, elems...), nil
+}
+
+func mappingIndex(n *yaml.Node, key string) int {
+	if n != nil && n.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == key {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func mustParse(t *testing.T, s string) *yaml.Node {
+	t.Helper()
+	n, err := parseDocument([]byte(s), yamlType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func encode(t *testing.T, n *yaml.Node) string {
+	t.Helper()
+	var m map[string]any
+	if err := n.Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	b, err := yaml.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestMergeNodes(t *testing.T) {
+	tests := []struct {
+		name string
+		dst  string
+		src  string
+		want string
+	}{
+		{
+			name: "maps merge",
+			dst:  "a: {b: 1, c: 2}",
+			src:  "a: {c: 3, d: 4}",
+			want: "a: {b: 1, c: 3, d: 4}",
+		},
+		{
+			name: "lists replace",
+			dst:  "a: [1, 2]",
+			src:  "a: [3]",
+			want: "a: [3]",
+		},
+		{
+			name: "null keeps the base value",
+			dst:  "a: 1\nb: {c: 2}",
+			src:  "a:\nb: ~",
+			want: "a: 1\nb: {c: 2}",
+		},
+		{
+			name: "value replaces null",
+			dst:  "a:",
+			src:  "a: 1",
+			want: "a: 1",
+		},
+		{
+			name: "merge key",
+			dst:  "defaults: &d {b: 1, c: 2}\na:\n  <<: *d\n  c: 3",
+			src:  "a: {b: 4}",
+			want: "defaults: {b: 1, c: 2}\na: {b: 4, c: 3}",
+		},
+		{
+			name: "merge key list",
+			dst:  "x: &x {b: 1}\ny: &y {b: 2, c: 2}\na: {<<: [*x, *y]}",
+			src:  "{}",
+			want: "x: {b: 1}\ny: {b: 2, c: 2}\na: {b: 1, c: 2}",
+		},
+		{
+			name: "alias is a copy",
+			dst:  "x: &x {b: 1}\na: *x",
+			src:  "a: {b: 2}",
+			want: "x: {b: 1}\na: {b: 2}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := encode(t, mergeNodes(mustParse(t, tt.dst), mustParse(t, tt.src)))
+			if want := encode(t, mustParse(t, tt.want)); got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestMergeKeyInvalid(t *testing.T) {
+	if _, err := parseDocument([]byte("a: {<<: [1, 2]}"), yamlType); err == nil {
+		t.Error("expected an error for a merge key of scalars")
+	}
+}
+
+func TestResolveAliasesLimits(t *testing.T) {
+	// each level is an anchored list of ten aliases of the previous one, so the last expands to 10^9 nodes
+	laughs := "l0: &l0 [lol, lol, lol, lol, lol, lol, lol, lol, lol, lol]\n"
+	for i := 1; i < 9; i++ {
+		laughs += fmt.Sprintf("l%d: &l%d [*l%d, *l%d, *l%d, *l%d, *l%d, *l%d, *l%d, *l%d, *l%d, *l%d]\n", i, i, i-1, i-1, i-1, i-1, i-1, i-1, i-1, i-1, i-1, i-1)
+	}
+	tests := []struct {
+		name string
+		doc  string
+		err  string
+	}{
+		{name: "self reference", doc: "a: &x\n  b: *x\n", err: "within its own anchored value"},
+		{name: "indirect self reference", doc: "a: &x\n  b: [c, {d: *x}]\n", err: "within its own anchored value"},
+		{name: "billion laughs", doc: laughs, err: "nodes with its aliases resolved"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			_, err := parseDocument([]byte(tt.doc), yamlType)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+			if d := time.Since(start); d > time.Second {
+				t.Errorf("took %v", d)
+			}
+		})
+	}
+	// a repeated alias is not a cycle
+	if _, err := parseDocument([]byte("x: &x {b: 1}\na: [*x, *x]\n"), yamlType); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMergeDocumentsRelativeOverlay(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "overlays"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	base := filepath.Join(dir, "config.yaml")
+	files := map[string]string{
+		base: "a: {b: 1}\nprofiles:\n  prod: {a: {c: 3}}",
+		filepath.Join(dir, "overlays", "dev.yaml"): "a: {b: 2}",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	doc, err := readDocument(base, yamlType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := newDocument(doc, base)
+	if err = mergeDocuments(d, base, dir, []string{filepath.Join("overlays", "dev.yaml")}, "prod"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := encode(t, d.root), encode(t, mustParse(t, "a: {b: 2, c: 3}")); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if err = mergeDocuments(newDocument(doc, base), base, dir, nil, "staging"); err == nil {
+		t.Error("expected an error for a missing profile")
+	}
+}
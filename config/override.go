@@ -0,0 +1,244 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// OverrideEnvPrefix is the prefix of environment variables overriding a yaml field, the rest of the
+	// variable name is the upper-cased yaml path joined by underscores, e.g. DENSIFY_CC_PROMETHEUS_SIGV4_REGION
+	OverrideEnvPrefix = "DENSIFY_CC_"
+	setFlag           = "set"
+	underscore        = "_"
+)
+
+// override sets the yaml field at path to value; source is used in error messages
+type override struct {
+	source string
+	path   []string
+	value  string
+}
+
+func addSetFlag(fs *pflag.FlagSet, sets *[]string) {
+	fs.StringArrayVar(sets, setFlag, nil, "override a yaml field, e.g. --set prometheus.retry.max_attempts=6 (may be repeated)")
+}
+
+// getOverrides returns the overrides from the environment followed by the overrides from --set flags, so
+// the latter take precedence (as flags do over environment variables for the fixed keys)
+func getOverrides(environ, sets []string) (ovs []*override, err error) {
+	var envOvs []*override
+	for _, kv := range environ {
+		name, val, _ := strings.Cut(kv, "=")
+		if rest, found := strings.CutPrefix(name, OverrideEnvPrefix); found {
+			path, ok := envPath(reflect.TypeFor[Parameters](), rest)
+			if !ok {
+				err = fmt.Errorf("environment variable %s: unknown yaml path", name)
+				return
+			}
+			envOvs = append(envOvs, &override{source: name, path: path, value: val})
+		}
+	}
+	// os.Environ() order is unspecified, make it deterministic
+	sort.Slice(envOvs, func(i, j int) bool { return envOvs[i].source < envOvs[j].source })
+	ovs = envOvs
+	for _, s := range sets {
+		path, val, found := strings.Cut(s, "=")
+		if !found || path == Empty {
+			err = fmt.Errorf("--%s %s: expected path=value", setFlag, s)
+			return
+		}
+		ovs = append(ovs, &override{source: "--" + setFlag + " " + path, path: splitPath(path), value: val})
+	}
+	return
+}
+
+// splitPath splits a yaml path such as clusters[0].identifiers.job (or clusters.0.identifiers.job)
+func splitPath(path string) []string {
+	path = strings.NewReplacer("[", Dot, "]", Empty).Replace(path)
+	return strings.Split(path, Dot)
+}
+
+func (p *Parameters) applyOverrides(ovs []*override) error {
+	v := reflect.ValueOf(p).Elem()
+	for _, ov := range ovs {
+		if err := setPath(v, ov.path, ov.value); err != nil {
+			return fmt.Errorf("%s: %w", ov.source, err)
+		}
+	}
+	return nil
+}
+
+// hasOverride indicates whether any of ovs sets a field under the yaml path prefix
+func hasOverride(ovs []*override, prefix ...string) bool {
+	for _, ov := range ovs {
+		if len(ov.path) >= len(prefix) && slices.Equal(ov.path[:len(prefix)], prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// overrideNode parses flow-style lists and maps as yaml for a field of type t which is not a leaf, any other
+// value is a plain scalar resolved according to t (so secrets such as "{x}" or containing ": " are kept as is)
+func overrideNode(t reflect.Type, value string) *yaml.Node {
+	if !isLeafType(t) && (strings.HasPrefix(value, "[") || strings.HasPrefix(value, "{")) {
+		doc := &yaml.Node{}
+		if err := yaml.Unmarshal([]byte(value), doc); err == nil && len(doc.Content) > 0 {
+			return doc.Content[0]
+		}
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+}
+
+func setPath(v reflect.Value, path []string, value string) error {
+	if len(path) == 0 {
+		return overrideNode(v.Type(), value).Decode(v.Addr().Interface())
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setPath(v.Elem(), path, value)
+	case reflect.Struct:
+		if f, ok := fieldByYamlName(v, path[0]); ok {
+			return setPath(f, path[1:], value)
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		key := reflect.ValueOf(path[0]).Convert(v.Type().Key())
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if existing := v.MapIndex(key); existing.IsValid() {
+			elem.Set(existing)
+		}
+		if err := setPath(elem, path[1:], value); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, elem)
+		return nil
+	case reflect.Slice:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i > v.Len() {
+			return fmt.Errorf("invalid index %s (list has %d elements)", path[0], v.Len())
+		}
+		if i == v.Len() {
+			v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+		}
+		return setPath(v.Index(i), path[1:], value)
+	}
+	return fmt.Errorf("unknown yaml path element %s", path[0])
+}
+
+func fieldByYamlName(v reflect.Value, name string) (f reflect.Value, ok bool) {
+	var sf reflect.StructField
+	if sf, ok = structFieldByYamlName(v.Type(), name); ok {
+		f = v.FieldByIndex(sf.Index)
+	}
+	return
+}
+
+// yamlTag returns the yaml name of an exported field, or an empty name if it is not (un)marshalled
+func yamlTag(sf reflect.StructField) (name string, inline bool) {
+	if !sf.IsExported() {
+		return
+	}
+	tag := sf.Tag.Get("yaml")
+	if tag == "-" {
+		return
+	}
+	name, opts, _ := strings.Cut(tag, Comma)
+	inline = strings.Contains(opts, "inline")
+	if name == Empty && !inline {
+		name = strings.ToLower(sf.Name)
+	}
+	return
+}
+
+// envPath resolves the upper-cased, underscore-joined rest of an override environment variable name into
+// a yaml path, guided by the type. Map keys are lower-cased
+func envPath(t reflect.Type, rest string) (path []string, ok bool) {
+	if rest == Empty {
+		return nil, true
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return envPath(t.Elem(), rest)
+	case reflect.Struct:
+		return envStructPath(t, rest)
+	case reflect.Map:
+		var key, next string
+		if isLeafType(t.Elem()) {
+			key = rest
+		} else {
+			key, next, _ = strings.Cut(rest, underscore)
+		}
+		if path, ok = envPath(t.Elem(), next); ok {
+			path = append([]string{strings.ToLower(key)}, path...)
+		}
+	case reflect.Slice:
+		index, next, _ := strings.Cut(rest, underscore)
+		if _, err := strconv.Atoi(index); err == nil {
+			if path, ok = envPath(t.Elem(), next); ok {
+				path = append([]string{index}, path...)
+			}
+		}
+	}
+	return
+}
+
+func envStructPath(t reflect.Type, rest string) (path []string, ok bool) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, inline := yamlTag(sf)
+		if inline {
+			if path, ok = envPath(sf.Type, rest); ok {
+				return
+			}
+			continue
+		}
+		if name == Empty {
+			continue
+		}
+		up := strings.ToUpper(name)
+		var next string
+		if rest == up {
+			next = Empty
+		} else if after, found := strings.CutPrefix(rest, up+underscore); found {
+			next = after
+		} else {
+			continue
+		}
+		if path, ok = envPath(sf.Type, next); ok {
+			path = append([]string{name}, path...)
+			return
+		}
+	}
+	return
+}
+
+func isLeafType(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Map, reflect.Slice:
+		return false
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if name, inline := yamlTag(t.Field(i)); name != Empty || inline {
+				return false
+			}
+		}
+	}
+	return true
+}
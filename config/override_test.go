@@ -0,0 +1,112 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnvPath(t *testing.T) {
+	tests := []struct {
+		rest string
+		want string
+	}{
+		{rest: "PROMETHEUS_URL_HOST", want: "prometheus.url.host"},
+		{rest: "PROMETHEUS_URL_ENCRYPTED_PASSWORD", want: "prometheus.url.encrypted_password"},
+		{rest: "COLLECTION_NODE_GROUP_LIST", want: "collection.node_group_list"},
+		{rest: "COLLECTION_INCLUDE_POD", want: "collection.include.pod"},
+		{rest: "CLUSTERS_1_IDENTIFIERS_JOB", want: "clusters.1.identifiers.job"},
+		{rest: "CLUSTERS_1_COLLECTION_HISTORY", want: "clusters.1.collection.history"},
+		{rest: "PROMETHEUS_BOGUS"},
+		{rest: "CLUSTERS_X_NAME"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rest, func(t *testing.T) {
+			path, ok := envPath(reflect.TypeFor[Parameters](), tt.rest)
+			if got := strings.Join(path, Dot); ok != (tt.want != Empty) || got != tt.want {
+				t.Errorf("got %s, %t, want %s", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitPath(t *testing.T) {
+	for _, path := range []string{"clusters[0].identifiers.job", "clusters.0.identifiers.job"} {
+		if got := splitPath(path); !reflect.DeepEqual(got, []string{"clusters", "0", "identifiers", "job"}) {
+			t.Errorf("%s: got %v", path, got)
+		}
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	yamlDoc := baseYaml + `collection:
+  history: 3
+`
+	tests := []struct {
+		name  string
+		env   map[string]string
+		sets  []string
+		check func(p *Parameters) bool
+		err   string
+	}{
+		{name: "env over the file", env: map[string]string{"DENSIFY_CC_PROMETHEUS_URL_HOST": "env-prom", "DENSIFY_CC_COLLECTION_HISTORY": "4"},
+			check: func(p *Parameters) bool {
+				return p.Prometheus.UrlConfig.Host == "env-prom" && p.Collection.History == 4
+			}},
+		{name: "set over env", env: map[string]string{"DENSIFY_CC_PROMETHEUS_URL_HOST": "env-prom"}, sets: []string{"prometheus.url.host=set-prom"},
+			check: func(p *Parameters) bool { return p.Prometheus.UrlConfig.Host == "set-prom" }},
+		{name: "set over a fixed key", sets: []string{"prometheus.url.host=set-prom", "--" + promHost + "=flag-prom"},
+			check: func(p *Parameters) bool { return p.Prometheus.UrlConfig.Host == "set-prom" }},
+		{name: "last set wins", sets: []string{"collection.history=5", "collection.history=6"},
+			check: func(p *Parameters) bool { return p.Collection.History == 6 }},
+		{name: "nested map key", env: map[string]string{"DENSIFY_CC_CLUSTERS_0_IDENTIFIERS_JOB": "kube"}, sets: []string{"collection.include.pod=false"},
+			check: func(p *Parameters) bool {
+				return p.Clusters[0].Identifiers["job"] == "kube" && p.Clusters[0].Name == "c0" && !p.Collection.Include["pod"]
+			}},
+		{name: "list index appends", sets: []string{"clusters[1].name=c1"},
+			check: func(p *Parameters) bool { return len(p.Clusters) == 2 && p.Clusters[1].Name == "c1" }},
+		{name: "flow-style list", sets: []string{"collection.node_group_list=[a, b]"},
+			check: func(p *Parameters) bool { return reflect.DeepEqual(p.Collection.NodeGroupList, StringList{"a", "b"}) }},
+		{name: "flow-style map", sets: []string{"collection.include={pod: false}"},
+			check: func(p *Parameters) bool { return !p.Collection.Include["pod"] }},
+		{name: "scalar looking like a flow-style value", sets: []string{"prometheus.url.password={x}", "prometheus.url.username=[u]"},
+			check: func(p *Parameters) bool {
+				return p.Prometheus.UrlConfig.Password == "{x}" && p.Prometheus.UrlConfig.Username == "[u]"
+			}},
+		{name: "scalar with a colon", sets: []string{"prometheus.bearer_token=a: b"},
+			check: func(p *Parameters) bool { return p.Prometheus.BearerToken == "a: b" }},
+		{name: "unknown env key", env: map[string]string{"DENSIFY_CC_PROMETHEUS_BOGUS": "x"}, err: "DENSIFY_CC_PROMETHEUS_BOGUS: unknown yaml path"},
+		{name: "unknown set key", sets: []string{"prometheus.bogus=x"}, err: "unknown yaml path element bogus"},
+		{name: "index out of range", sets: []string{"clusters[5].name=c5"}, err: "invalid index 5"},
+		{name: "no value", sets: []string{"prometheus.url.host"}, err: "expected path=value"},
+		{name: "type error", sets: []string{"collection.history=abc"}, err: "--set collection.history"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			var args []string
+			for _, s := range tt.sets {
+				if strings.HasPrefix(s, "--") {
+					args = append(args, s)
+				} else {
+					args = append(args, "--"+setFlag, s)
+				}
+			}
+			p, err := loadDir(t, map[string]string{"config.yaml": yamlDoc}, args...)
+			if tt.err != Empty {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(p) {
+				t.Errorf("unexpected parameters: %+v", p)
+			}
+		})
+	}
+}
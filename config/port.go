@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type portState int
+
+const (
+	portAuto portState = iota
+	portNumber
+	portNone
+)
+
+const (
+	PortAuto = "auto"
+	PortNone = "none"
+)
+
+// Port is an optional port of a UrlConfig. It is unmarshalled from:
+//   - an empty value or "auto" - the port is unset, the scheme's default port is used
+//   - "none" - the port is omitted from the resolved Url
+//   - a number - the port itself (the legacy IgnorePort sentinel is migrated to "none")
+//
+// The zero value is "auto"
+type Port struct {
+	number uint64
+	state  portState
+}
+
+// NoPort is the Port which is omitted from the resolved Url
+var NoPort = Port{state: portNone}
+
+func NewPort(n uint64) Port {
+	return Port{number: n, state: portNumber}
+}
+
+func ParsePort(s string) (p Port, err error) {
+	switch s = strings.ToLower(strings.TrimSpace(s)); s {
+	case Empty, PortAuto:
+	case PortNone:
+		p = NoPort
+	default:
+		var n uint64
+		if n, err = strconv.ParseUint(s, 10, 64); err != nil {
+			err = fmt.Errorf("invalid port %s: must be a number, %s or %s", s, PortAuto, PortNone)
+			return
+		}
+		if n == IgnorePort {
+			p = NoPort
+		} else {
+			p = NewPort(n)
+		}
+	}
+	return
+}
+
+func (p Port) IsAuto() bool {
+	return p.state == portAuto
+}
+
+func (p Port) IsNone() bool {
+	return p.state == portNone
+}
+
+// Number returns the port number, ok is false if the port is either "auto" or "none"
+func (p Port) Number() (n uint64, ok bool) {
+	return p.number, p.state == portNumber
+}
+
+func (p Port) String() string {
+	switch p.state {
+	case portNumber:
+		return strconv.FormatUint(p.number, 10)
+	case portNone:
+		return PortNone
+	}
+	return PortAuto
+}
+
+func (p *Port) UnmarshalYAML(node *yaml.Node) (err error) {
+	var s string
+	if err = node.Decode(&s); err == nil {
+		*p, err = ParsePort(s)
+	}
+	return
+}
+
+func (p Port) MarshalYAML() (any, error) {
+	if n, ok := p.Number(); ok {
+		return n, nil
+	}
+	return p.String(), nil
+}
+
+// Set and Type implement pflag.Value
+
+func (p *Port) Set(s string) (err error) {
+	*p, err = ParsePort(s)
+	return
+}
+
+func (p *Port) Type() string {
+	return "port"
+}
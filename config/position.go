@@ -0,0 +1,182 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlLine matches the line yaml.v3 gives its syntax and type errors as text, which have no position field
+var yamlLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// PositionError is an error at a position of a config file (or of a remote config, File being its URL):
+// Line is 0 if the line is unknown, e.g. for a toml value, which is decoded without its position
+type PositionError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *PositionError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.File, e.Err)
+}
+
+func (e *PositionError) Unwrap() error {
+	return e.Err
+}
+
+// atLine returns err at line of a file not known yet, see inFile
+func atLine(line int, err error) error {
+	return &PositionError{Line: line, Err: err}
+}
+
+// inFile returns err positioned in file, keeping its line if it has one
+func inFile(file string, err error) error {
+	if pe, ok := err.(*PositionError); ok && pe.File == Empty {
+		pe.File = file
+		return pe
+	}
+	return &PositionError{File: file, Err: err}
+}
+
+// syntaxError returns the line of a yaml or toml syntax error along with it, see inFile
+func syntaxError(err error) error {
+	var te interface{ Position() (row, column int) }
+	if errors.As(err, &te) {
+		row, _ := te.Position()
+		return atLine(row, err)
+	}
+	if m := yamlLine.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return atLine(line, errors.New(m[2]))
+	}
+	return err
+}
+
+// fieldError is an error of the field at path (yaml names and list indexes), found at finalize time
+type fieldError struct {
+	path []string
+	err  error
+}
+
+func (e *fieldError) Error() string {
+	return e.err.Error()
+}
+
+func (e *fieldError) Unwrap() error {
+	return e.err
+}
+
+func atField(err error, path ...string) error {
+	if err == nil {
+		return nil
+	}
+	return &fieldError{path: path, err: err}
+}
+
+// document is a config document merged from several sources - config files and a remote config - which
+// keeps the source of each of its nodes, so errors can be positioned where their values were read from
+type document struct {
+	root    *yaml.Node
+	sources map[*yaml.Node]string
+}
+
+func newDocument(root *yaml.Node, source string) *document {
+	d := &document{root: root, sources: make(map[*yaml.Node]string)}
+	d.add(root, source)
+	return d
+}
+
+// add records source as the source of n and of its descendants
+func (d *document) add(n *yaml.Node, source string) {
+	d.sources[n] = source
+	for _, c := range n.Content {
+		d.add(c, source)
+	}
+}
+
+// errorAt returns err positioned at n, or err if the source of n is unknown
+func (d *document) errorAt(n *yaml.Node, err error) error {
+	if source, ok := d.sources[n]; ok {
+		return &PositionError{File: source, Line: n.Line, Err: err}
+	}
+	return err
+}
+
+// decodeError splits a yaml.TypeError, whose errors only give their line as text: an error is positioned
+// if all the scalar values of the document at its line (or all the values, if there is no scalar value, as a
+// map or list starts at the line of its first element) come from the same source, otherwise its line is
+// dropped
+func (d *document) decodeError(err error) error {
+	var te *yaml.TypeError
+	if !errors.As(err, &te) {
+		return err
+	}
+	errs := make([]error, len(te.Errors))
+	for i, msg := range te.Errors {
+		errs[i] = errors.New(msg)
+		if m := yamlLine.FindStringSubmatch(msg); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			errs[i] = errors.New(m[2])
+			sources := d.sourcesAt(d.root, line, true, nil)
+			if len(sources) == 0 {
+				sources = d.sourcesAt(d.root, line, false, nil)
+			}
+			if len(sources) == 1 {
+				errs[i] = &PositionError{File: sources[0], Line: line, Err: errs[i]}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sourcesAt appends the sources of the (scalar) values below n at line to sources, keys are not values
+func (d *document) sourcesAt(n *yaml.Node, line int, scalars bool, sources []string) []string {
+	for i, c := range n.Content {
+		if n.Kind == yaml.MappingNode && i%2 == 0 {
+			continue
+		}
+		if source := d.sources[c]; c.Line == line && (!scalars || c.Kind == yaml.ScalarNode) && !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+		sources = d.sourcesAt(c, line, scalars, sources)
+	}
+	return sources
+}
+
+// fieldPosition positions a fieldError at the deepest key of its path found in the document; a field
+// which is not in the document (e.g. set by a flag) is not positioned
+func (d *document) fieldPosition(err error) error {
+	var fe *fieldError
+	if d == nil || !errors.As(err, &fe) {
+		return err
+	}
+	var key *yaml.Node
+	for n, path := d.root, fe.path; n != nil && len(path) > 0; path = path[1:] {
+		switch n.Kind {
+		case yaml.MappingNode:
+			if i := mappingIndex(n, path[0]); i >= 0 {
+				key, n = n.Content[i], n.Content[i+1]
+				continue
+			}
+		case yaml.SequenceNode:
+			if i, e := strconv.Atoi(path[0]); e == nil && i >= 0 && i < len(n.Content) {
+				n = n.Content[i]
+				key = n
+				continue
+			}
+		}
+		n = nil
+	}
+	if key == nil {
+		return err
+	}
+	return d.errorAt(key, err)
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// positions returns the file:line of each of the errors joined in err, "-" for an error without position
+func positions(err error) (ps []string) {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			ps = append(ps, positions(e)...)
+		}
+		return
+	}
+	var pe *PositionError
+	if !errors.As(err, &pe) {
+		return []string{"-"}
+	}
+	return []string{filepath.Base(pe.File) + ":" + strconv.Itoa(pe.Line)}
+}
+
+func TestPositions(t *testing.T) {
+	const base = "prometheus:\n  url:\n    host: prom\n"
+	tests := []struct {
+		name    string
+		config  string
+		overlay string
+		opts    []Option
+		want    []string
+	}{
+		{name: "unknown fields", config: base + "collection:\n  bogus: 1\n", overlay: "collection:\n  history: 1\n  other: 2\n", opts: []Option{WithStrict()}, want: []string{"config.yaml:5", "overlay.yaml:3"}},
+		{name: "type error in overlay", config: base + "collection:\n  history: 1\n", overlay: "collection:\n  history: abc\n", want: []string{"overlay.yaml:2"}},
+		{name: "syntax error in overlay", config: base, overlay: "a: b\n  c: d\n", want: []string{"overlay.yaml:2"}},
+		{name: "toml syntax error", config: "[prometheus\n", want: []string{"config.toml:1"}},
+		{name: "finalize error", config: base + "collection:\n  interval: weeks\n", want: []string{"config.yaml:4"}},
+		{name: "finalize error of a cluster", config: base + "clusters:\n  - name: c0\n  - name: c1\n    collection:\n      interval: weeks\n", want: []string{"config.yaml:7"}},
+		{name: "finalize error of a flag", config: base, opts: []Option{WithArgs("--" + interval + "=weeks")}, want: []string{"-"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			name := "config.yaml"
+			if tt.config[0] == '[' {
+				name = "config.toml"
+			}
+			files := map[string]string{name: tt.config}
+			opts := tt.opts
+			if tt.overlay != Empty {
+				files["overlay.yaml"] = tt.overlay
+				opts = append(opts, WithOverlays(filepath.Join(dir, "overlay.yaml")))
+			}
+			for name, content := range files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err := LoadFile(filepath.Join(dir, name), opts...)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := positions(err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got positions %v, want %v: %v", got, tt.want, err)
+			}
+		})
+	}
+}
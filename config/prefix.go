@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	prefixDateLayout = "20060102"
+	// PrefixEnvPrefix is the prefix of the environment variables allowed in {{.Env "NAME"}}, besides prefixEnvVars
+	PrefixEnvPrefix  = "DENSIFY_PREFIX_"
+	placeholderOpen  = "{{"
+	placeholderClose = "}}"
+)
+
+var (
+	prefixValid   = regexp.MustCompile(`^[A-Za-z0-9._-]*$`)
+	prefixInvalid = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+	// prefixPlaceholder matches the placeholders of the prefix, the only ones allowed
+	prefixPlaceholder = regexp.MustCompile(`\{\{\s*\.(ClusterName|Date|Hostname|Env\s+"([A-Za-z_][A-Za-z0-9_]*)")\s*\}\}`)
+	// prefixEnvVars are the environment variables allowed in {{.Env "NAME"}}, typically set by the Kubernetes
+	// downward API; others could leak secrets into the file names
+	prefixEnvVars = []string{"POD_NAMESPACE", "POD_NAME", "NODE_NAME", "CLUSTER_NAME", "HOSTNAME"}
+)
+
+// PrefixContext holds the values of the zip file prefix placeholders:
+//   - {{.ClusterName}} - the cluster name
+//   - {{.Date}} - the date (UTC) of Time, as YYYYMMDD
+//   - {{.Hostname}} - the host name
+//   - {{.Env "NAME"}} - the value of environment variable NAME, which must be one of POD_NAMESPACE,
+//     POD_NAME, NODE_NAME, CLUSTER_NAME and HOSTNAME, or start with PrefixEnvPrefix
+//
+// Characters other than letters, digits, '.', '_' and '-' in the values are replaced by '-'.
+// A zero Time is the current time, an empty Hostname is the host name of the machine and
+// a nil Getenv is os.Getenv
+type PrefixContext struct {
+	ClusterName string
+	Hostname    string
+	Time        time.Time
+	Getenv      func(string) string
+}
+
+func (pc PrefixContext) Date() string {
+	return pc.Time.UTC().Format(prefixDateLayout)
+}
+
+func (pc PrefixContext) Env(name string) string {
+	return sanitizePrefix(pc.Getenv(name))
+}
+
+func (pc PrefixContext) withDefaults() PrefixContext {
+	if pc.Time.IsZero() {
+		pc.Time = time.Now()
+	}
+	if pc.Hostname == Empty {
+		pc.Hostname, _ = os.Hostname()
+	}
+	if pc.Getenv == nil {
+		pc.Getenv = os.Getenv
+	}
+	pc.ClusterName = sanitizePrefix(pc.ClusterName)
+	pc.Hostname = sanitizePrefix(pc.Hostname)
+	return pc
+}
+
+func sanitizePrefix(s string) string {
+	return prefixInvalid.ReplaceAllString(s, "-")
+}
+
+// RenderPrefix returns the zip file prefix, with its placeholders replaced by the values of ctx
+func (fp *ForwarderParameters) RenderPrefix(ctx PrefixContext) (prefix string, err error) {
+	ctx = ctx.withDefaults()
+	var sb strings.Builder
+	last := 0
+	for _, m := range prefixPlaceholder.FindAllStringSubmatchIndex(fp.Prefix, -1) {
+		literal, env := fp.Prefix[last:m[0]], Empty
+		if m[4] >= 0 {
+			env = fp.Prefix[m[4]:m[5]]
+		}
+		var v string
+		if err = checkLiteral(literal); err == nil {
+			v, err = ctx.value(fp.Prefix[m[2]:m[3]], env)
+		}
+		if err != nil {
+			break
+		}
+		sb.WriteString(literal)
+		sb.WriteString(v)
+		last = m[1]
+	}
+	if err == nil {
+		err = checkLiteral(fp.Prefix[last:])
+	}
+	if err != nil {
+		err = fmt.Errorf("invalid prefix %s: %w", fp.Prefix, err)
+		return
+	}
+	sb.WriteString(fp.Prefix[last:])
+	if prefix = sb.String(); !prefixValid.MatchString(prefix) {
+		err = fmt.Errorf("invalid prefix %s: only letters, digits, '.', '_' and '-' are allowed", fp.Prefix)
+		prefix = Empty
+	}
+	return
+}
+
+// value returns the value of the placeholder name, env is the environment variable of {{.Env "NAME"}}
+func (pc PrefixContext) value(name, env string) (string, error) {
+	switch name {
+	case "ClusterName":
+		return pc.ClusterName, nil
+	case "Date":
+		return pc.Date(), nil
+	case "Hostname":
+		return pc.Hostname, nil
+	}
+	if !slices.Contains(prefixEnvVars, env) && !strings.HasPrefix(env, PrefixEnvPrefix) {
+		return Empty, fmt.Errorf("environment variable %s is not allowed, use one of %s or a name starting with %s", env, strings.Join(prefixEnvVars, ", "), PrefixEnvPrefix)
+	}
+	return pc.Env(env), nil
+}
+
+// checkLiteral reports a placeholder other than the allowed ones in the literal text s of the prefix
+func checkLiteral(s string) error {
+	if strings.Contains(s, placeholderOpen) || strings.Contains(s, placeholderClose) {
+		return fmt.Errorf("unknown placeholder in %s, only {{.ClusterName}}, {{.Date}}, {{.Hostname}} and {{.Env \"NAME\"}} are allowed", s)
+	}
+	return nil
+}
+
+// validatePrefix renders the prefix with sample values, to report placeholder errors and invalid characters
+func (fp *ForwarderParameters) validatePrefix() (err error) {
+	_, err = fp.RenderPrefix(PrefixContext{
+		ClusterName: "cluster",
+		Hostname:    "host",
+		Time:        time.Unix(0, 0),
+		Getenv:      func(string) string { return "env" },
+	})
+	return
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRenderPrefix(t *testing.T) {
+	env := map[string]string{"POD_NAMESPACE": "monitoring", "DENSIFY_PREFIX_TEAM": "a/b", "DB_PASSWORD": "secret"}
+	ctx := PrefixContext{
+		ClusterName: "prod cluster",
+		Hostname:    "node-1",
+		Time:        time.Date(2026, 10, 19, 23, 0, 0, 0, time.FixedZone("east", 3*3600)),
+		Getenv:      func(name string) string { return env[name] },
+	}
+	tests := []struct {
+		prefix string
+		want   string
+		err    bool
+	}{
+		{prefix: Empty, want: Empty},
+		{prefix: "static", want: "static"},
+		{prefix: "{{.ClusterName}}-{{.Date}}-{{.Hostname}}", want: "prod-cluster-20261019-node-1"},
+		{prefix: `{{ .Env "POD_NAMESPACE" }}_{{.Env "DENSIFY_PREFIX_TEAM"}}`, want: "monitoring_a-b"},
+		{prefix: `{{.Env "DB_PASSWORD"}}`, err: true},
+		{prefix: "{{.Time}}", err: true},
+		{prefix: `{{.Getenv "DB_PASSWORD"}}`, err: true},
+		{prefix: `{{printf "%s" .ClusterName}}`, err: true},
+		{prefix: "{{.ClusterName}", err: true},
+		{prefix: "a}}b", err: true},
+		{prefix: "a b", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			fp := &ForwarderParameters{Prefix: tt.prefix}
+			got, err := fp.RenderPrefix(ctx)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,449 @@
+package config
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// preflight steps
+const (
+	StepProxyConnect = "proxy_connect"
+	StepTcpConnect   = "tcp_connect"
+	StepTlsHandshake = "tls_handshake"
+	StepToken        = "token"
+	StepRequest      = "request"
+)
+
+const (
+	// preflightTimeout bounds the checks of each endpoint, unless the context has an earlier deadline
+	preflightTimeout = 10 * time.Second
+	buildInfoPath    = "/api/v1/status/buildinfo"
+)
+
+// PreflightStep is the outcome of a step of checking an endpoint; Skipped is the reason a step which cannot
+// be verified was not run, a skipped step is not a failure
+type PreflightStep struct {
+	Name    string        `json:"name"`
+	Latency time.Duration `json:"latency"`
+	Error   string        `json:"error,omitempty"`
+	Skipped string        `json:"skipped,omitempty"`
+}
+
+// EndpointReport lists the steps of checking an endpoint, up to the first failed (or skipped) one
+type EndpointReport struct {
+	Name  string          `json:"name"`
+	Url   string          `json:"url"`
+	Steps []PreflightStep `json:"steps"`
+}
+
+func (er *EndpointReport) Ok() bool {
+	for _, s := range er.Steps {
+		if s.Error != Empty {
+			return false
+		}
+	}
+	return true
+}
+
+// Report is the outcome of Preflight
+type Report struct {
+	Endpoints []*EndpointReport `json:"endpoints"`
+}
+
+func (r Report) Ok() bool {
+	for _, er := range r.Endpoints {
+		if !er.Ok() {
+			return false
+		}
+	}
+	return true
+}
+
+func (r Report) String() string {
+	var sb strings.Builder
+	for _, er := range r.Endpoints {
+		_, _ = fmt.Fprintf(&sb, "%s (%s):\n", er.Name, er.Url)
+		for _, s := range er.Steps {
+			switch {
+			case s.Error != Empty:
+				_, _ = fmt.Fprintf(&sb, "    %s: %s (%v)\n", s.Name, s.Error, s.Latency)
+			case s.Skipped != Empty:
+				_, _ = fmt.Fprintf(&sb, "    %s: skipped, %s\n", s.Name, s.Skipped)
+			default:
+				_, _ = fmt.Fprintf(&sb, "    %s: ok (%v)\n", s.Name, s.Latency)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// PreflightOption is an option of Preflight
+type PreflightOption func(*preflightOptions)
+
+type preflightOptions struct {
+	tlsConfig *tls.Config
+}
+
+// WithTLSConfig sets the base TLS config of all the endpoints (e.g. the root CAs of test servers)
+func WithTLSConfig(cfg *tls.Config) PreflightOption {
+	return func(o *preflightOptions) {
+		o.tlsConfig = cfg
+	}
+}
+
+// client returns the http client of the requests which are not to an endpoint (e.g. to a token endpoint)
+func (o *preflightOptions) client() *http.Client {
+	if o.tlsConfig == nil {
+		return nil
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = o.tlsConfig
+	return &http.Client{Transport: tr}
+}
+
+// preflightTarget is an endpoint to check
+type preflightTarget struct {
+	name       string
+	uc         *UrlConfig
+	proxy      *ProxyParameters
+	tlsConfig  *tls.Config
+	caCertPath string
+	// request builds the lightweight request, fetching a token if needed
+	request func(ctx context.Context, report func(string, time.Time, error)) (*http.Request, error)
+	// wrap wraps the transport of the request (e.g. sigv4 signing), if not nil
+	wrap func(http.RoundTripper) (http.RoundTripper, error)
+	// accept checks the response status
+	accept func(status int) bool
+}
+
+// Preflight checks the connectivity of Prometheus and of the Densify destinations (through the proxy, if
+// any): for each endpoint a TCP connect (or a CONNECT through the proxy), the TLS handshake for https, and
+// an authenticated lightweight request - /api/v1/status/buildinfo for Prometheus, a HEAD of the endpoint
+// for Densify. Each step is reported with its latency, and the checks of an endpoint stop at the first
+// failed step. p must be finalized
+func Preflight(ctx context.Context, p *Parameters, opts ...PreflightOption) (r Report) {
+	o := &preflightOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	var targets []*preflightTarget
+	if p.Prometheus != nil && p.Prometheus.UrlConfig != nil {
+		targets = append(targets, p.Prometheus.preflightTarget(o))
+	}
+	if p.Forwarder != nil {
+		for _, d := range p.Forwarder.Destinations {
+			if d.Densify == nil {
+				continue
+			}
+			name := DestinationDensify
+			if !p.Forwarder.implicitDestinations {
+				name += Slash + d.Name
+			}
+			targets = append(targets, d.Densify.preflightTarget(name, p.Forwarder.Proxy, o))
+		}
+	}
+	for _, t := range targets {
+		r.Endpoints = append(r.Endpoints, t.run(ctx))
+	}
+	return
+}
+
+func (pp *PrometheusParameters) preflightTarget(o *preflightOptions) *preflightTarget {
+	return &preflightTarget{
+		name:       "prometheus",
+		uc:         pp.UrlConfig,
+		tlsConfig:  o.tlsConfig,
+		caCertPath: pp.CaCertPath,
+		request: func(ctx context.Context, _ func(string, time.Time, error)) (req *http.Request, err error) {
+			var u string
+			if u, err = url.JoinPath(pp.UrlConfig.Url, buildInfoPath); err != nil {
+				return
+			}
+			if req, err = http.NewRequestWithContext(ctx, http.MethodGet, u, nil); err != nil {
+				return
+			}
+			err = pp.authorize(req)
+			return
+		},
+		wrap: pp.wrap,
+		accept: func(status int) bool {
+			return status == http.StatusOK
+		},
+	}
+}
+
+func (dp *DensifyParameters) preflightTarget(name string, proxy *ProxyParameters, o *preflightOptions) *preflightTarget {
+	return &preflightTarget{
+		name:      name,
+		uc:        dp.UrlConfig,
+		proxy:     proxy,
+		tlsConfig: o.tlsConfig,
+		request: func(ctx context.Context, report func(string, time.Time, error)) (req *http.Request, err error) {
+			var u *url.URL
+			if u, err = dp.EndpointURL(); err != nil {
+				return
+			}
+			if req, err = http.NewRequestWithContext(ctx, http.MethodHead, u.String(), nil); err != nil {
+				return
+			}
+			if dp.Auth == nil {
+				return
+			}
+			switch dp.Auth.Type {
+			case AuthBasic:
+				// an encrypted password can only be checked by Densify itself, so the request would fail
+				if dp.Auth.Basic.Password == Empty {
+					err = errSkipped("the encrypted password cannot be sent, the credentials are not verified")
+					return
+				}
+				var password string
+				if password, err = readSecret(dp.Auth.Basic.Password); err == nil {
+					req.SetBasicAuth(dp.Auth.Basic.Username, password)
+				}
+			case AuthToken:
+				var token string
+				if token, err = dp.Auth.Token.Value(); err == nil {
+					req.Header.Set("Authorization", "Bearer "+token)
+				}
+			case AuthJwtExchange:
+				start := time.Now()
+				var token string
+				token, err = dp.Auth.JwtExchange.Exchange(ctx, o.client())
+				report(StepToken, start, err)
+				if err == nil {
+					req.Header.Set("Authorization", "Bearer "+token)
+				} else {
+					err = errReported
+				}
+			}
+			return
+		},
+		accept: func(status int) bool {
+			// the endpoint may not allow HEAD, which still shows it is reachable
+			return status < http.StatusBadRequest || status == http.StatusMethodNotAllowed
+		},
+	}
+}
+
+// errReported indicates a step failed and has already been reported
+var errReported = errors.New("reported")
+
+// errSkipped is the reason a step is skipped
+type errSkipped string
+
+func (e errSkipped) Error() string {
+	return string(e)
+}
+
+func (t *preflightTarget) run(ctx context.Context) (er *EndpointReport) {
+	er = &EndpointReport{Name: t.name, Url: t.uc.Url}
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+	report := func(name string, start time.Time, err error) {
+		s := PreflightStep{Name: name, Latency: time.Since(start)}
+		if err != nil {
+			s.Error = err.Error()
+		}
+		er.Steps = append(er.Steps, s)
+	}
+	step := func(name string, f func() error) bool {
+		start := time.Now()
+		err := f()
+		report(name, start, err)
+		return err == nil
+	}
+	if t.uc.Url == Empty {
+		report(StepTcpConnect, time.Now(), fmt.Errorf("url is not set"))
+		return
+	}
+	u, err := url.Parse(t.uc.Url)
+	if err != nil {
+		report(StepTcpConnect, time.Now(), err)
+		return
+	}
+	addr := t.uc.dialAddr(u)
+	var conn net.Conn
+	if t.proxy != nil && t.proxy.UrlConfig != nil && t.proxy.UrlConfig.Url != Empty && t.uc.Dialer != UnixDialer {
+		if !step(StepProxyConnect, func() (e error) {
+			conn, e = t.proxy.connect(ctx, addr, t.tlsConfig)
+			return
+		}) {
+			return
+		}
+	} else if !step(StepTcpConnect, func() (e error) {
+		conn, e = t.uc.DialContext()(ctx, "tcp", addr)
+		return
+	}) {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+	if u.Scheme == Https && !step(StepTlsHandshake, func() (e error) {
+		var cfg *tls.Config
+		if cfg, e = clientTLSConfig(t.tlsConfig, u.Hostname(), t.caCertPath); e == nil {
+			tlsConn := tls.Client(conn, cfg)
+			if e = tlsConn.HandshakeContext(ctx); e == nil {
+				conn = tlsConn
+			}
+		}
+		return
+	}) {
+		return
+	}
+	req, err := t.request(ctx, report)
+	var skipped errSkipped
+	switch {
+	case errors.As(err, &skipped):
+		er.Steps = append(er.Steps, PreflightStep{Name: StepRequest, Skipped: string(skipped)})
+		return
+	case err != nil:
+		if !errors.Is(err, errReported) {
+			report(StepRequest, time.Now(), err)
+		}
+		return
+	}
+	step(StepRequest, func() error {
+		return t.roundTrip(req, conn)
+	})
+	return
+}
+
+// clientTLSConfig returns a clone of base (an empty config if nil), with the certificates of caCertPath
+// (if any) added to its root CAs
+func clientTLSConfig(base *tls.Config, serverName, caCertPath string) (cfg *tls.Config, err error) {
+	if base != nil {
+		cfg = base.Clone()
+	} else {
+		cfg = &tls.Config{}
+	}
+	if cfg.ServerName == Empty {
+		cfg.ServerName = serverName
+	}
+	if caCertPath != Empty {
+		var pem []byte
+		if pem, err = os.ReadFile(caCertPath); err != nil {
+			return
+		}
+		if cfg.RootCAs == nil {
+			cfg.RootCAs = x509.NewCertPool()
+		}
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			err = fmt.Errorf("no certificates in %s", caCertPath)
+		}
+	}
+	return
+}
+
+// roundTrip sends req over conn, which is already connected (and TLS handshaked) to the endpoint
+func (t *preflightTarget) roundTrip(req *http.Request, conn net.Conn) (err error) {
+	dial := func(context.Context, string, string) (net.Conn, error) {
+		return conn, nil
+	}
+	tr := t.uc.Transport(nil)
+	tr.Proxy = nil
+	tr.DialContext = dial
+	tr.DialTLSContext = dial
+	tr.DisableKeepAlives = true
+	var rt http.RoundTripper = tr
+	if t.wrap != nil {
+		if rt, err = t.wrap(rt); err != nil {
+			return
+		}
+	}
+	var resp *http.Response
+	if resp, err = rt.RoundTrip(req); err != nil {
+		return
+	}
+	_ = resp.Body.Close()
+	if !t.accept(resp.StatusCode) {
+		switch resp.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			err = fmt.Errorf("authentication failed: %s", resp.Status)
+		default:
+			err = fmt.Errorf("unexpected response: %s", resp.Status)
+		}
+	}
+	return
+}
+
+// connect opens a tunnel to addr through the proxy with the CONNECT method; only basic proxy auth is sent
+func (pp *ProxyParameters) connect(ctx context.Context, addr string, tlsConfig *tls.Config) (conn net.Conn, err error) {
+	var u *url.URL
+	if u, err = url.Parse(pp.UrlConfig.Url); err != nil {
+		return
+	}
+	if conn, err = pp.UrlConfig.DialContext()(ctx, "tcp", pp.UrlConfig.dialAddr(u)); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = conn.Close()
+			conn = nil
+		}
+	}()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if u.Scheme == Https {
+		cfg := &tls.Config{}
+		if tlsConfig != nil {
+			cfg = tlsConfig.Clone()
+		}
+		cfg.ServerName = u.Hostname()
+		tlsConn := tls.Client(conn, cfg)
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			return
+		}
+		conn = tlsConn
+	}
+	req := &http.Request{Method: http.MethodConnect, URL: &url.URL{Opaque: addr}, Host: addr, Header: make(http.Header)}
+	if pp.UrlConfig.Username != Empty && !strings.EqualFold(pp.Auth, "NTLM") {
+		var user, password string
+		if user, err = readSecret(pp.UrlConfig.Username); err != nil {
+			return
+		}
+		if password, err = readSecret(pp.UrlConfig.Password); err != nil {
+			return
+		}
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+password)))
+	}
+	if err = req.Write(conn); err != nil {
+		return
+	}
+	var resp *http.Response
+	if resp, err = http.ReadResponse(bufio.NewReader(conn), req); err != nil {
+		return
+	}
+	// the body of a successful response is the tunnel
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		err = fmt.Errorf("proxy CONNECT %s: %s", addr, resp.Status)
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return
+}
+
+// dialAddr is the address the resolved Url u of uc is reached at: its port if it has one, else the resolved
+// port of uc (or the default port of the scheme of u, if uc is not finalized)
+func (uc *UrlConfig) dialAddr(u *url.URL) string {
+	if u.Port() != Empty {
+		return u.Host
+	}
+	port := uc.ResolvedPort
+	if spec, ok := lookupScheme(u.Scheme); ok && port == 0 {
+		port = spec.DefaultPort
+	}
+	return net.JoinHostPort(u.Hostname(), strconv.FormatUint(port, 10))
+}
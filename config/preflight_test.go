@@ -0,0 +1,199 @@
+package config
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// serverUrl returns the finalized UrlConfig of srv
+func serverUrl(t *testing.T, srv *httptest.Server) *UrlConfig {
+	t.Helper()
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := strconv.ParseUint(u.Port(), 10, 64)
+	uc := &UrlConfig{Scheme: u.Scheme, Host: u.Hostname(), Port: NewPort(port)}
+	if err = uc.finalize(); err != nil {
+		t.Fatal(err)
+	}
+	return uc
+}
+
+// trusting returns the option trusting the certificate of srv
+func trusting(srv *httptest.Server) PreflightOption {
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	return WithTLSConfig(&tls.Config{RootCAs: pool})
+}
+
+// connectProxy is a proxy serving CONNECT only, it counts the tunnels
+func connectProxy(t *testing.T) (srv *httptest.Server, tunnels *atomic.Int32) {
+	t.Helper()
+	tunnels = new(atomic.Int32)
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		tunnels.Add(1)
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			_ = upstream.Close()
+			return
+		}
+		_, _ = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go func() {
+			_, _ = io.Copy(upstream, conn)
+			_ = upstream.Close()
+		}()
+		_, _ = io.Copy(conn, upstream)
+		_ = conn.Close()
+	}))
+	t.Cleanup(srv.Close)
+	return
+}
+
+// stepNames returns the names of the steps of er, with the outcome of the failed or skipped ones
+func stepNames(er *EndpointReport) (names []string) {
+	for _, s := range er.Steps {
+		name := s.Name
+		switch {
+		case s.Error != Empty:
+			name += " failed"
+		case s.Skipped != Empty:
+			name += " skipped"
+		}
+		names = append(names, name)
+	}
+	return
+}
+
+func TestPreflightPrometheus(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path != buildInfoPath:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Header.Get("Authorization") != "Bearer good":
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+	tests := []struct {
+		name    string
+		token   string
+		trusted bool
+		steps   string
+		err     string
+	}{
+		{name: "ok", token: "good", trusted: true, steps: "tcp_connect tls_handshake request"},
+		{name: "untrusted certificate", token: "good", steps: "tcp_connect tls_handshake failed", err: "certificate"},
+		{name: "rejected token", token: "bad", trusted: true, steps: "tcp_connect tls_handshake request failed", err: "authentication failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []PreflightOption
+			if tt.trusted {
+				opts = append(opts, trusting(srv))
+			}
+			p := &Parameters{Prometheus: &PrometheusParameters{UrlConfig: serverUrl(t, srv), BearerToken: tt.token}}
+			r := Preflight(context.Background(), p, opts...)
+			er := r.Endpoints[0]
+			if got := strings.Join(stepNames(er), " "); got != tt.steps {
+				t.Errorf("got steps %s, want %s", got, tt.steps)
+			}
+			if last := er.Steps[len(er.Steps)-1]; !strings.Contains(last.Error, tt.err) || r.Ok() != (tt.err == Empty) {
+				t.Errorf("got error %q, ok %t", last.Error, r.Ok())
+			}
+		})
+	}
+}
+
+func TestPreflightDensify(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if user, password, ok := r.BasicAuth(); !ok || user != "u" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+	proxy, tunnels := connectProxy(t)
+	tests := []struct {
+		name      string
+		basic     BasicAuth
+		proxy     bool
+		steps     string
+		requests  int32
+		tunnelled int32
+	}{
+		{name: "password", basic: BasicAuth{Username: "u", Password: "secret"}, steps: "tcp_connect tls_handshake request", requests: 1},
+		{name: "wrong password", basic: BasicAuth{Username: "u", Password: "other"}, steps: "tcp_connect tls_handshake request failed", requests: 1},
+		{name: "encrypted password", basic: BasicAuth{Username: "u", EncryptedPassword: "c2VjcmV0"}, steps: "tcp_connect tls_handshake request skipped"},
+		{name: "through the proxy", basic: BasicAuth{Username: "u", Password: "secret"}, proxy: true, steps: "proxy_connect tls_handshake request", requests: 1, tunnelled: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests.Store(0)
+			tunnels.Store(0)
+			dp := &DensifyParameters{UrlConfig: serverUrl(t, srv), Endpoint: "/api/v2/", Auth: &DensifyAuth{Type: AuthBasic, Basic: &tt.basic}}
+			fp := &ForwarderParameters{Destinations: []*Destination{{Name: "d", Densify: dp}}}
+			if tt.proxy {
+				fp.Proxy = &ProxyParameters{UrlConfig: serverUrl(t, proxy)}
+			}
+			r := Preflight(context.Background(), &Parameters{Forwarder: fp}, trusting(srv))
+			if got := strings.Join(stepNames(r.Endpoints[0]), " "); got != tt.steps {
+				t.Errorf("got steps %s, want %s:\n%s", got, tt.steps, r)
+			}
+			if requests.Load() != tt.requests || tunnels.Load() != tt.tunnelled {
+				t.Errorf("got %d requests and %d tunnels, want %d and %d", requests.Load(), tunnels.Load(), tt.requests, tt.tunnelled)
+			}
+			// a skipped step is not a failure
+			if failed := strings.HasSuffix(tt.steps, "failed"); r.Ok() == failed {
+				t.Errorf("got ok %t:\n%s", r.Ok(), r)
+			}
+		})
+	}
+}
+
+func TestDialAddr(t *testing.T) {
+	tests := []struct {
+		uc   UrlConfig
+		want string
+	}{
+		{UrlConfig{Scheme: Http, Host: "prom"}, "prom:80"},
+		{UrlConfig{Scheme: Https, Host: "prom", Port: NewPort(8443)}, "prom:8443"},
+		{UrlConfig{Scheme: Https, Host: "prom", Port: NoPort}, "prom:443"},
+		{UrlConfig{Scheme: H2c, Host: "densify/api"}, "densify:80"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			uc := tt.uc
+			if err := uc.finalize(); err != nil {
+				t.Fatal(err)
+			}
+			u, err := url.Parse(uc.Url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := uc.dialAddr(u); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
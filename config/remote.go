@@ -0,0 +1,216 @@
+package config
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// SignatureHeader is the response header carrying the HMAC-SHA256 signature of a remote config
+	SignatureHeader     = "X-Densify-Signature"
+	signaturePrefix     = "sha256="
+	remoteTimeout       = 30 * time.Second
+	remoteCacheDir      = "densify"
+	remoteCachePrefix   = "remote-config-"
+	remoteMaxSize       = 10 << 20
+	remoteCacheDirPerms = 0700
+)
+
+// remoteConfig is an optional yaml config fetched over http(s), which the local config is merged on top of
+type remoteConfig struct {
+	url       string
+	cachePath string
+	// sha256 is the expected hex-encoded checksum of the remote config
+	sha256 string
+	// hmacKey is the key verifying the signature in the SignatureHeader response header
+	hmacKey string
+	// offline indicates only the cached remote config is used, without contacting the endpoint
+	offline bool
+}
+
+// remoteCache is the last successfully fetched remote config, used for conditional requests and when the
+// remote endpoint is unreachable
+type remoteCache struct {
+	Url          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Signature    string `json:"signature,omitempty"`
+	Body         []byte `json:"body"`
+}
+
+// cacheFile is the cache path, by default a file of the user cache directory named by the hash of the url,
+// so different remote configs do not share a cache
+func (rc *remoteConfig) cacheFile() (string, error) {
+	if rc.cachePath != Empty {
+		return rc.cachePath, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return Empty, err
+	}
+	sum := sha256.Sum256([]byte(rc.url))
+	return filepath.Join(dir, remoteCacheDir, remoteCachePrefix+hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// integrityChecked indicates the remote config is verified by a checksum or a signature
+func (rc *remoteConfig) integrityChecked() bool {
+	return rc.sha256 != Empty || rc.hmacKey != Empty
+}
+
+// fetch returns the remote config: the fetched one if it has changed, the cached one if it has not
+// changed, the endpoint is unreachable or the remote config is offline. Only a remote config verified by a
+// checksum or a signature is cached, as nothing else tells a cached config from a tampered one
+func (rc *remoteConfig) fetch(ctx context.Context) (body []byte, err error) {
+	var cache, fetched *remoteCache
+	if rc.integrityChecked() {
+		cache = rc.readCache()
+	}
+	if rc.offline {
+		if cache == nil {
+			err = fmt.Errorf("remote config %s is not cached (only a verified one is) and cannot be fetched offline", rc.url)
+		} else if err = rc.verify(cache); err == nil {
+			body = cache.Body
+		}
+		return
+	}
+	if fetched, err = rc.get(ctx, cache); err != nil {
+		if cache == nil {
+			return
+		}
+		slog.Warn("remote config endpoint unreachable, using the cached config", "url", rc.url, "error", err)
+		fetched = cache
+	}
+	if err = rc.verify(fetched); err != nil {
+		return
+	}
+	if fetched != cache && rc.integrityChecked() {
+		if e := rc.writeCache(fetched); e != nil {
+			slog.Warn("failed to cache the remote config", "url", rc.url, "error", e)
+		}
+	}
+	body = fetched.Body
+	return
+}
+
+func (rc *remoteConfig) get(ctx context.Context, cache *remoteCache) (fetched *remoteCache, err error) {
+	ctx, cancel := context.WithTimeout(ctx, remoteTimeout)
+	defer cancel()
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, http.MethodGet, rc.url, nil); err != nil {
+		return
+	}
+	if cache != nil {
+		if cache.ETag != Empty {
+			req.Header.Set("If-None-Match", cache.ETag)
+		}
+		if cache.LastModified != Empty {
+			req.Header.Set("If-Modified-Since", cache.LastModified)
+		}
+	}
+	var resp *http.Response
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cache != nil:
+		fetched = cache
+	case resp.StatusCode == http.StatusOK:
+		fetched = &remoteCache{
+			Url:          rc.url,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Signature:    resp.Header.Get(SignatureHeader),
+		}
+		// read one byte past the limit, to tell a body at the limit from a larger one
+		if fetched.Body, err = io.ReadAll(io.LimitReader(resp.Body, remoteMaxSize+1)); err == nil && len(fetched.Body) > remoteMaxSize {
+			err = fmt.Errorf("fetching remote config %s: larger than %d bytes", rc.url, remoteMaxSize)
+		}
+		if err != nil {
+			fetched = nil
+		}
+	default:
+		err = fmt.Errorf("fetching remote config %s: %s", rc.url, resp.Status)
+	}
+	return
+}
+
+func (rc *remoteConfig) verify(fetched *remoteCache) error {
+	if rc.sha256 != Empty {
+		sum := sha256.Sum256(fetched.Body)
+		if !strings.EqualFold(hex.EncodeToString(sum[:]), rc.sha256) {
+			return fmt.Errorf("remote config %s: checksum mismatch", rc.url)
+		}
+	}
+	if rc.hmacKey != Empty {
+		mac := hmac.New(sha256.New, []byte(rc.hmacKey))
+		mac.Write(fetched.Body)
+		expected, err := hex.DecodeString(strings.TrimPrefix(fetched.Signature, signaturePrefix))
+		if err != nil || !hmac.Equal(mac.Sum(nil), expected) {
+			return fmt.Errorf("remote config %s: invalid or missing %s", rc.url, SignatureHeader)
+		}
+	}
+	return nil
+}
+
+// readCache returns the cached remote config, or nil if there is none for this url
+func (rc *remoteConfig) readCache() (cache *remoteCache) {
+	path, err := rc.cacheFile()
+	if err != nil {
+		return
+	}
+	var data []byte
+	if data, err = os.ReadFile(path); err != nil {
+		return
+	}
+	cache = &remoteCache{}
+	if err = json.Unmarshal(data, cache); err != nil || cache.Url != rc.url {
+		cache = nil
+	}
+	return
+}
+
+// writeCache writes a temporary file - created exclusively, so an existing file or symlink is never
+// written through - and renames it, so a concurrent reader never sees a partial cache
+func (rc *remoteConfig) writeCache(cache *remoteCache) (err error) {
+	var data []byte
+	if data, err = json.Marshal(cache); err != nil {
+		return
+	}
+	var path string
+	if path, err = rc.cacheFile(); err != nil {
+		return
+	}
+	dir := filepath.Dir(path)
+	if err = os.MkdirAll(dir, remoteCacheDirPerms); err != nil {
+		return
+	}
+	var f *os.File
+	if f, err = os.CreateTemp(dir, filepath.Base(path)+".*"); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+	_, err = f.Write(data)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	return
+}
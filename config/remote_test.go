@@ -0,0 +1,229 @@
+package config
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const remoteYaml = `
+prometheus:
+  url:
+    host: remote-prom
+collection:
+  history: 2
+forwarder:
+  proxy:
+    domain: ${REMOTE_TEST_DOMAIN:-none}
+`
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// remoteServer serves body, with an ETag and the signature of key (if not empty); it counts the requests
+// and answers conditional ones with 304
+func remoteServer(t *testing.T, body, key string) (srv *httptest.Server, requests *int) {
+	t.Helper()
+	requests = new(int)
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		if key != Empty {
+			mac := hmac.New(sha256.New, []byte(key))
+			mac.Write([]byte(body))
+			w.Header().Set(SignatureHeader, signaturePrefix+hex.EncodeToString(mac.Sum(nil)))
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return
+}
+
+func TestRemoteFetch(t *testing.T) {
+	srv, requests := remoteServer(t, remoteYaml, "secret")
+	rc := &remoteConfig{url: srv.URL, cachePath: filepath.Join(t.TempDir(), "cache.json"), hmacKey: "secret"}
+	for i := 0; i < 2; i++ {
+		body, err := rc.fetch(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != remoteYaml {
+			t.Fatalf("fetch %d: got %q", i, body)
+		}
+	}
+	if *requests != 2 {
+		t.Errorf("got %d requests, want 2", *requests)
+	}
+	// unreachable and offline, from the cache
+	srv.Close()
+	for _, offline := range []bool{false, true} {
+		rc.offline = offline
+		if body, err := rc.fetch(context.Background()); err != nil || string(body) != remoteYaml {
+			t.Errorf("offline %t: got %q, %v", offline, body, err)
+		}
+	}
+	// the cached config is verified too
+	rc.hmacKey = "other"
+	if _, err := rc.fetch(context.Background()); err == nil {
+		t.Error("expected a signature error")
+	}
+}
+
+func TestRemoteVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		rc      remoteConfig
+		invalid bool
+	}{
+		{name: "none", rc: remoteConfig{}},
+		{name: "sha256", rc: remoteConfig{sha256: strings.ToUpper(sha256Hex([]byte(remoteYaml)))}},
+		{name: "sha256 mismatch", rc: remoteConfig{sha256: sha256Hex([]byte("other"))}, invalid: true},
+		{name: "hmac", key: "secret", rc: remoteConfig{hmacKey: "secret"}},
+		{name: "hmac mismatch", key: "other", rc: remoteConfig{hmacKey: "secret"}, invalid: true},
+		{name: "hmac missing", rc: remoteConfig{hmacKey: "secret"}, invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := remoteServer(t, remoteYaml, tt.key)
+			rc := tt.rc
+			rc.url, rc.cachePath = srv.URL, filepath.Join(t.TempDir(), "cache.json")
+			if _, err := rc.fetch(context.Background()); (err != nil) != tt.invalid {
+				t.Errorf("got error %v, want an error: %t", err, tt.invalid)
+			}
+		})
+	}
+}
+
+func TestRemoteTooLarge(t *testing.T) {
+	for _, size := range []int{remoteMaxSize, remoteMaxSize + 1} {
+		srv, _ := remoteServer(t, "#"+strings.Repeat("x", size-1), Empty)
+		rc := &remoteConfig{url: srv.URL, cachePath: filepath.Join(t.TempDir(), "cache.json")}
+		if _, err := rc.fetch(context.Background()); (err != nil) != (size > remoteMaxSize) {
+			t.Errorf("size %d: got error %v", size, err)
+		}
+	}
+}
+
+func TestRemoteCacheFile(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheDir)
+	t.Setenv("HOME", cacheDir)
+	a, b := &remoteConfig{url: "https://a/config.yaml"}, &remoteConfig{url: "https://b/config.yaml"}
+	pa, err := a.cacheFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pb, _ := b.cacheFile(); pa == pb {
+		t.Errorf("remote configs share the cache file %s", pa)
+	}
+	if dir, _ := os.UserCacheDir(); filepath.Dir(pa) != filepath.Join(dir, remoteCacheDir) {
+		t.Errorf("got cache file %s, want one in the user cache directory", pa)
+	}
+	if c, _ := (&remoteConfig{url: a.url, cachePath: "/cache.json"}).cacheFile(); c != "/cache.json" {
+		t.Errorf("got cache file %s", c)
+	}
+	// the default directory is private to the user, the file too
+	if err = a.writeCache(&remoteCache{Url: a.url, Body: []byte(remoteYaml)}); err != nil {
+		t.Fatal(err)
+	}
+	for path, perm := range map[string]os.FileMode{filepath.Dir(pa): remoteCacheDirPerms, pa: 0600} {
+		if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != perm {
+			t.Errorf("%s: got %v, %v, want permissions %v", path, fi.Mode().Perm(), err, perm)
+		}
+	}
+}
+
+func TestRemoteWriteCacheSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target")
+	if err := os.WriteFile(target, []byte("unchanged"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rc := &remoteConfig{url: "https://a/config.yaml", cachePath: filepath.Join(dir, "cache.json")}
+	if err := os.Symlink(target, rc.cachePath); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.writeCache(&remoteCache{Url: rc.url, Body: []byte(remoteYaml)}); err != nil {
+		t.Fatal(err)
+	}
+	// the symlink is replaced, not written through, and no temporary file is left
+	if b, _ := os.ReadFile(target); string(b) != "unchanged" {
+		t.Errorf("the symlink target was written: %q", b)
+	}
+	if fi, err := os.Lstat(rc.cachePath); err != nil || !fi.Mode().IsRegular() {
+		t.Errorf("got cache file %v, %v", fi, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("got %d files, want 2", len(entries))
+	}
+}
+
+func TestRemoteUnverifiedCache(t *testing.T) {
+	srv, requests := remoteServer(t, remoteYaml, Empty)
+	rc := &remoteConfig{url: srv.URL, cachePath: filepath.Join(t.TempDir(), "cache.json")}
+	for i := 0; i < 2; i++ {
+		if body, err := rc.fetch(context.Background()); err != nil || string(body) != remoteYaml {
+			t.Fatalf("fetch %d: got %q, %v", i, body, err)
+		}
+	}
+	// an unverified remote config is neither cached nor fetched conditionally
+	if _, err := os.Stat(rc.cachePath); !os.IsNotExist(err) {
+		t.Errorf("unverified remote config cached: %v", err)
+	}
+	if *requests != 2 {
+		t.Errorf("got %d requests, want 2", *requests)
+	}
+	// nor is a cache entry trusted, even if there is one
+	if err := rc.writeCache(&remoteCache{Url: rc.url, Body: []byte(remoteYaml)}); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+	for _, offline := range []bool{false, true} {
+		rc.offline = offline
+		if _, err := rc.fetch(context.Background()); err == nil {
+			t.Errorf("offline %t: expected an error", offline)
+		}
+	}
+}
+
+func TestRemoteLoad(t *testing.T) {
+	t.Setenv("REMOTE_TEST_DOMAIN", "expanded")
+	srv, _ := remoteServer(t, remoteYaml, Empty)
+	tests := []struct {
+		name   string
+		files  map[string]string
+		args   []string
+		domain string
+		host   string
+	}{
+		{name: "unverified", files: map[string]string{"config.yaml": "debug: true\n"}, domain: "${REMOTE_TEST_DOMAIN:-none}", host: "remote-prom"},
+		{name: "verified", files: map[string]string{"config.yaml": "debug: true\n"}, args: []string{"--" + configUrlSha256 + "=" + sha256Hex([]byte(remoteYaml))}, domain: "expanded", host: "remote-prom"},
+		{name: "properties", files: map[string]string{"config.properties": "prometheus_address=local-prom\n"}, domain: "${REMOTE_TEST_DOMAIN:-none}", host: "local-prom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"--" + configUrl + "=" + srv.URL, "--" + configUrlCache + "=" + filepath.Join(t.TempDir(), "cache.json")}, tt.args...)
+			p, err := loadDir(t, tt.files, args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Forwarder.Proxy.Domain != tt.domain || p.Prometheus.UrlConfig.Host != tt.host || p.Collection.History != 2 {
+				t.Errorf("got domain %q, host %s, history %d", p.Forwarder.Proxy.Domain, p.Prometheus.UrlConfig.Host, p.Collection.History)
+			}
+		})
+	}
+}
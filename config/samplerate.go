@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+)
+
+// SampleRate is the resolution of the collection queries. It is unmarshalled from:
+//   - a Prometheus duration, e.g. 30s, 5m or 1h30m
+//   - a plain number - a number of minutes (the legacy format)
+type SampleRate time.Duration
+
+func NewSampleRate(d time.Duration) SampleRate {
+	return SampleRate(d)
+}
+
+func ParseSampleRate(s string) (sr SampleRate, err error) {
+	s = strings.TrimSpace(s)
+	if n, e := strconv.ParseUint(s, 10, 64); e == nil {
+		sr = SampleRate(time.Duration(n) * time.Minute)
+		return
+	}
+	var d model.Duration
+	if d, err = model.ParseDuration(s); err != nil {
+		err = fmt.Errorf("invalid sample rate %s: must be a duration (e.g. 30s, 5m) or a number of minutes", s)
+		return
+	}
+	sr = SampleRate(d)
+	return
+}
+
+func (sr SampleRate) Duration() time.Duration {
+	return time.Duration(sr)
+}
+
+// Step returns the sample rate as a PromQL duration, e.g. for range vector selectors and subqueries
+func (sr SampleRate) Step() string {
+	return model.Duration(sr).String()
+}
+
+// Minutes returns the sample rate in minutes, ok is false if it is not a whole number of minutes
+func (sr SampleRate) Minutes() (n uint64, ok bool) {
+	d := sr.Duration()
+	return uint64(d / time.Minute), d > 0 && d%time.Minute == 0
+}
+
+func (sr SampleRate) String() string {
+	return sr.Step()
+}
+
+func (sr *SampleRate) UnmarshalYAML(node *yaml.Node) (err error) {
+	var s string
+	if err = node.Decode(&s); err == nil {
+		*sr, err = ParseSampleRate(s)
+	}
+	return
+}
+
+func (sr SampleRate) MarshalYAML() (any, error) {
+	return sr.String(), nil
+}
+
+// Set and Type implement pflag.Value
+
+func (sr *SampleRate) Set(s string) (err error) {
+	*sr, err = ParseSampleRate(s)
+	return
+}
+
+func (sr *SampleRate) Type() string {
+	return "duration"
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxScheduleRuns bounds the number of consecutive runs checked for gaps and overlaps
+const maxScheduleRuns = 10000
+
+// ScheduleParameters describes when the collection runs (e.g. the schedule of its CronJob):
+//   - Cron is a standard 5-field cron expression, or a macro such as @hourly or @daily
+//   - Timezone is the IANA time zone of the cron expression, UTC by default
+//   - Jitter is the maximum delay of a run after its scheduled time
+//
+// Each run collects the window ending at its scheduled time, so the runs must be spaced exactly by the
+// collection window (history times interval size of interval) - otherwise data is either missed or collected
+// twice. Runs spaced by the window on the wall clock across a daylight saving time change are accepted
+// though, e.g. the runs of a daily schedule 23 or 25 hours apart, whose windows miss or overlap by an hour
+type ScheduleParameters struct {
+	Cron     string        `yaml:"cron"`
+	Timezone string        `yaml:"timezone,omitempty"`
+	Jitter   time.Duration `yaml:"jitter,omitempty"`
+	cron     *cronSchedule
+	location *time.Location
+}
+
+// clone returns a copy of sp, which shares the parsed cron expression and location as they are not modified
+func (sp *ScheduleParameters) clone() *ScheduleParameters {
+	if sp == nil {
+		return nil
+	}
+	c := *sp
+	return &c
+}
+
+func (sp *ScheduleParameters) init() (err error) {
+	if sp.cron != nil {
+		return
+	}
+	var loc *time.Location
+	if loc, err = time.LoadLocation(sp.Timezone); err != nil {
+		return
+	}
+	var cs *cronSchedule
+	if cs, err = parseCron(sp.Cron); err != nil {
+		return
+	}
+	sp.cron, sp.location = cs, loc
+	return
+}
+
+// Next returns the first scheduled time strictly after t, or the zero time if there is none
+func (sp *ScheduleParameters) Next(t time.Time) (time.Time, error) {
+	if err := sp.init(); err != nil {
+		return time.Time{}, err
+	}
+	return sp.cron.next(t.In(sp.location)), nil
+}
+
+// validate checks that consecutive runs are spaced by exactly window (elapsed or on the wall clock), and that
+// the jitter is shorter
+func (sp *ScheduleParameters) validate(window time.Duration) (err error) {
+	if err = sp.init(); err != nil {
+		return
+	}
+	if sp.Jitter < 0 || sp.Jitter >= window {
+		err = fmt.Errorf("schedule jitter %v must be non-negative and shorter than the collection window of %v", sp.Jitter, window)
+		return
+	}
+	// check a year of runs (at most maxScheduleRuns) from a fixed reference, so validation is deterministic
+	start := time.Date(2001, time.January, 1, 0, 0, 0, 0, sp.location)
+	end := start.AddDate(1, 0, 0)
+	prev := sp.cron.next(start)
+	if prev.IsZero() {
+		err = fmt.Errorf("schedule %s never runs", sp.Cron)
+		return
+	}
+	for i := 0; i < maxScheduleRuns && prev.Before(end); i++ {
+		next := sp.cron.next(prev)
+		if next.IsZero() {
+			break
+		}
+		switch gap := next.Sub(prev); {
+		case gap == window || wallClock(next).Sub(wallClock(prev)) == window:
+		case gap > window:
+			err = fmt.Errorf("schedule %s leaves a gap: runs at %v and %v are %v apart, the collection window is %v", sp.Cron, prev, next, gap, window)
+		case gap < window:
+			err = fmt.Errorf("schedule %s overlaps: runs at %v and %v are %v apart, the collection window is %v", sp.Cron, prev, next, gap, window)
+		}
+		if err != nil {
+			return
+		}
+		prev = next
+	}
+	return
+}
+
+// wallClock returns the time in UTC with the same wall clock as t, so the difference of wall clocks can be
+// taken across a daylight saving time change
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// WindowAt returns the collection window of a run at t: it ends at the scheduled time of the run (the last
+// one at or before t, which absorbs the jitter) minus the offset, and spans the collection window
+func (cp *CollectionParameters) WindowAt(t time.Time) (start, end time.Time, err error) {
+	if cp.Schedule == nil {
+		err = fmt.Errorf("no schedule configured")
+		return
+	}
+	if err = cp.Schedule.init(); err != nil {
+		return
+	}
+	var plan *CollectionPlan
+	if plan, err = cp.Plan(); err != nil {
+		return
+	}
+	scheduled := cp.Schedule.cron.prev(t.In(cp.Schedule.location))
+	if scheduled.IsZero() {
+		err = fmt.Errorf("no scheduled run at or before %v", t)
+		return
+	}
+	end = scheduled.Add(-plan.Offset)
+	start = end.Add(-plan.runWindow())
+	return
+}
+
+// runWindow is the time range collected by a run - all of its queries
+func (plan *CollectionPlan) runWindow() time.Duration {
+	return plan.Window * time.Duration(plan.Queries)
+}
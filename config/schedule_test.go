@@ -0,0 +1,89 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduleValidate(t *testing.T) {
+	const day = 24 * time.Hour
+	tests := []struct {
+		name   string
+		sp     ScheduleParameters
+		window time.Duration
+		err    string
+	}{
+		{name: "daily", sp: ScheduleParameters{Cron: "@daily"}, window: day},
+		{name: "hourly with jitter", sp: ScheduleParameters{Cron: "5 * * * *", Jitter: 10 * time.Minute}, window: time.Hour},
+		// the runs are 23 and 25 hours apart across the daylight saving time changes
+		{name: "daily across daylight saving time", sp: ScheduleParameters{Cron: "0 0 * * *", Timezone: "America/New_York"}, window: day},
+		{name: "twice a day across daylight saving time", sp: ScheduleParameters{Cron: "0 6,18 * * *", Timezone: "Europe/Paris"}, window: 12 * time.Hour},
+		{name: "hourly across daylight saving time", sp: ScheduleParameters{Cron: "@hourly", Timezone: "America/New_York"}, window: time.Hour},
+		{name: "weekly", sp: ScheduleParameters{Cron: "0 0 * * 7", Timezone: "Australia/Sydney"}, window: 7 * day},
+		{name: "gap", sp: ScheduleParameters{Cron: "@daily"}, window: 12 * time.Hour, err: "leaves a gap"},
+		{name: "overlap", sp: ScheduleParameters{Cron: "@daily"}, window: 2 * day, err: "overlaps"},
+		{name: "uneven hours", sp: ScheduleParameters{Cron: "0 */7 * * *"}, window: 7 * time.Hour, err: "overlaps"},
+		{name: "weekdays", sp: ScheduleParameters{Cron: "0 0 * * 1-5"}, window: day, err: "leaves a gap"},
+		{name: "two hours off across daylight saving time", sp: ScheduleParameters{Cron: "0 0 * * *", Timezone: "America/New_York"}, window: day + 2*time.Hour, err: "overlaps"},
+		{name: "jitter as long as the window", sp: ScheduleParameters{Cron: "@hourly", Jitter: time.Hour}, window: time.Hour, err: "jitter"},
+		{name: "negative jitter", sp: ScheduleParameters{Cron: "@hourly", Jitter: -time.Minute}, window: time.Hour, err: "jitter"},
+		{name: "never runs", sp: ScheduleParameters{Cron: "0 0 30 2 *"}, window: day, err: "never runs"},
+		{name: "unknown time zone", sp: ScheduleParameters{Cron: "@daily", Timezone: "Nowhere/City"}, window: day, err: "unknown time zone"},
+		{name: "invalid cron", sp: ScheduleParameters{Cron: "@never"}, window: day, err: "expected 5 fields"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp := tt.sp
+			err := sp.validate(tt.window)
+			if tt.err == Empty && err != nil || tt.err != Empty && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestWindowAt(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	cp := &CollectionParameters{
+		Interval:     Hours,
+		IntervalSize: 1,
+		History:      24,
+		Offset:       1,
+		SampleRate:   SampleRate(5 * time.Minute),
+		Schedule:     &ScheduleParameters{Cron: "@daily", Timezone: "America/New_York", Jitter: 30 * time.Minute},
+	}
+	tests := []struct {
+		name string
+		at   time.Time
+		end  time.Time
+	}{
+		// a run delayed by the jitter collects the window of its scheduled time
+		{name: "jitter", at: time.Date(2024, 5, 1, 0, 20, 0, 0, ny), end: time.Date(2024, 4, 30, 23, 0, 0, 0, ny)},
+		{name: "on time", at: time.Date(2024, 5, 1, 0, 0, 0, 0, ny), end: time.Date(2024, 4, 30, 23, 0, 0, 0, ny)},
+		// in another time zone
+		{name: "utc", at: time.Date(2024, 5, 1, 4, 10, 0, 0, time.UTC), end: time.Date(2024, 4, 30, 23, 0, 0, 0, ny)},
+		{name: "after daylight saving time starts", at: time.Date(2024, 3, 11, 0, 5, 0, 0, ny), end: time.Date(2024, 3, 10, 23, 0, 0, 0, ny)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, err := cp.WindowAt(tt.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !end.Equal(tt.end) || end.Sub(start) != 24*time.Hour {
+				t.Errorf("got %v - %v, want the 24h ending at %v", start, end, tt.end)
+			}
+		})
+	}
+	next, err := cp.Schedule.Next(time.Date(2024, 5, 1, 0, 20, 0, 0, ny))
+	if err != nil || !next.Equal(time.Date(2024, 5, 2, 0, 0, 0, 0, ny)) {
+		t.Errorf("got next %v, %v", next, err)
+	}
+	if _, _, err = (&CollectionParameters{}).WindowAt(time.Now()); err == nil {
+		t.Error("expected an error without a schedule")
+	}
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DialerHint tells an http client factory how to reach the address of a resolved UrlConfig
+type DialerHint int
+
+const (
+	TcpDialer DialerHint = iota
+	UnixDialer
+	H2cDialer
+)
+
+const (
+	Unix = "unix"
+	H2c  = "h2c"
+	// unixHost is the placeholder host of the resolved Url of a unix domain socket UrlConfig
+	unixHost = "localhost"
+)
+
+// SchemeSpec describes a scheme which can be used in UrlConfig:
+//   - UrlScheme is the scheme of the resolved Url (e.g. h2c and unix are spoken as plain http)
+//   - DefaultPort is used if the port is not set
+//   - OmitPort indicates whether the port should be left out of the resolved Url; if nil, the port is
+//     omitted when it equals DefaultPort
+//   - Dialer is the hint for the http client factory
+type SchemeSpec struct {
+	UrlScheme   string
+	DefaultPort uint64
+	OmitPort    func(port uint64) bool
+	Dialer      DialerHint
+}
+
+var schemes = struct {
+	sync.RWMutex
+	m map[string]*SchemeSpec
+}{
+	m: map[string]*SchemeSpec{
+		Http:  {UrlScheme: Http, DefaultPort: DefaultHttpPort},
+		Https: {UrlScheme: Https, DefaultPort: DefaultHttpsPort},
+		H2c:   {UrlScheme: Http, DefaultPort: DefaultHttpPort, Dialer: H2cDialer},
+		Unix:  {UrlScheme: Http, OmitPort: func(uint64) bool { return true }, Dialer: UnixDialer},
+	},
+}
+
+// RegisterScheme adds a scheme to the registry (or replaces an existing one), making it valid in UrlConfig
+func RegisterScheme(name string, spec *SchemeSpec) error {
+	if name == Empty || spec == nil || spec.UrlScheme == Empty {
+		return fmt.Errorf("invalid scheme spec for %s", name)
+	}
+	schemes.Lock()
+	defer schemes.Unlock()
+	schemes.m[strings.ToLower(name)] = spec
+	return nil
+}
+
+func lookupScheme(name string) (spec *SchemeSpec, ok bool) {
+	schemes.RLock()
+	defer schemes.RUnlock()
+	spec, ok = schemes.m[name]
+	return
+}
+
+func (spec *SchemeSpec) omitPort(port uint64) bool {
+	if spec.OmitPort != nil {
+		return spec.OmitPort(port)
+	}
+	return port == spec.DefaultPort
+}
+
+// DialContext returns the dial function to be used by an http.Transport for this UrlConfig
+func (uc *UrlConfig) DialContext() func(ctx context.Context, network, addr string) (net.Conn, error) {
+	d := &net.Dialer{}
+	if uc != nil && uc.Dialer == UnixDialer {
+		socket := uc.SocketPath
+		return func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return d.DialContext(ctx, Unix, socket)
+		}
+	}
+	return d.DialContext
+}
+
+// Transport returns a clone of base (http.DefaultTransport if nil) able to reach this UrlConfig
+func (uc *UrlConfig) Transport(base *http.Transport) (t *http.Transport) {
+	if base == nil {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	t = base.Clone()
+	t.DialContext = uc.DialContext()
+	if uc != nil && uc.Dialer == H2cDialer {
+		t.Protocols = &http.Protocols{}
+		t.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return
+}
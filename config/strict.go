@@ -0,0 +1,68 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+var unmarshalerType = reflect.TypeFor[yaml.Unmarshaler]()
+
+// checkKnownFields reports every key of n which is not a field of t (strict mode), regardless of the
+// format the node was parsed from; each unknown field is an error at its position
+func checkKnownFields(d *document, t reflect.Type) error {
+	var errs []error
+	checkNode(d, d.root, t, Empty, &errs)
+	return errors.Join(errs...)
+}
+
+func checkNode(d *document, n *yaml.Node, t reflect.Type, path string, errs *[]error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	// types with custom unmarshalling are checked by their own UnmarshalYAML
+	if reflect.PointerTo(t).Implements(unmarshalerType) {
+		return
+	}
+	switch {
+	case t.Kind() == reflect.Struct && n.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k := n.Content[i]
+			if sf, ok := structFieldByYamlName(t, k.Value); ok {
+				checkNode(d, n.Content[i+1], sf.Type, joinPath(path, k.Value), errs)
+			} else {
+				*errs = append(*errs, d.errorAt(k, fmt.Errorf("%s: unknown field", joinPath(path, k.Value))))
+			}
+		}
+	case t.Kind() == reflect.Map && n.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			checkNode(d, n.Content[i+1], t.Elem(), joinPath(path, n.Content[i].Value), errs)
+		}
+	case t.Kind() == reflect.Slice && n.Kind == yaml.SequenceNode:
+		for i, c := range n.Content {
+			checkNode(d, c, t.Elem(), path+"["+strconv.Itoa(i)+"]", errs)
+		}
+	}
+}
+
+// structFieldByYamlName looks up the field of t with the given yaml name, Index of the returned field is
+// relative to t even if the field belongs to an inline struct
+func structFieldByYamlName(t reflect.Type, name string) (sf reflect.StructField, ok bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tagName, inline := yamlTag(f)
+		switch {
+		case inline && f.Type.Kind() == reflect.Struct:
+			if sf, ok = structFieldByYamlName(f.Type, name); ok {
+				sf.Index = append([]int{i}, sf.Index...)
+				return
+			}
+		case tagName != Empty && tagName == name:
+			return f, true
+		}
+	}
+	return
+}
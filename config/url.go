@@ -8,13 +8,17 @@ import (
 )
 
 type UrlConfig struct {
-	Scheme            string `yaml:"scheme"`
-	Host              string `yaml:"host"`
-	Port              uint64 `yaml:"port"`
-	Username          string `yaml:"username,omitempty"`
-	Password          string `yaml:"password,omitempty"`
-	EncryptedPassword string `yaml:"encrypted_password,omitempty"`
-	Url               string `yaml:"-"`
+	Scheme            string     `yaml:"scheme"`
+	Host              string     `yaml:"host"`
+	Port              Port       `yaml:"port"`
+	Username          string     `yaml:"username,omitempty"`
+	Password          string     `yaml:"password,omitempty"`
+	EncryptedPassword string     `yaml:"encrypted_password,omitempty"`
+	Url               string     `yaml:"-"`
+	SocketPath        string     `yaml:"-"`
+	Dialer            DialerHint `yaml:"-"`
+	// ResolvedPort is the port Url is reached at, the default port of its scheme if Url has none
+	ResolvedPort uint64 `yaml:"-"`
 }
 
 const (
@@ -23,11 +27,12 @@ const (
 	Https                   = Http + "s"
 	DefaultHttpPort  uint64 = 80
 	DefaultHttpsPort uint64 = 443
-	IgnorePort       uint64 = 99999 // 0 is a valid port, need another invalid value indicating "ignore me"
+	// IgnorePort is the legacy "no port" sentinel, it is migrated to NoPort when parsing a Port.
+	//
+	// Deprecated: use NoPort (or "none" in configuration) instead
+	IgnorePort uint64 = 99999
 )
 
-var validSchemes = map[string]bool{Http: true, Https: true}
-
 func (uc *UrlConfig) numMandatory() (n int) {
 	if uc != nil {
 		if uc.Scheme != Empty {
@@ -48,23 +53,40 @@ func (uc *UrlConfig) finalize() (err error) {
 		err = fmt.Errorf("invalid UrlConfig")
 		return
 	}
-	var sc string
-	if sc, err = validScheme(uc.Scheme); err != nil {
+	var spec *SchemeSpec
+	if spec, err = validScheme(uc.Scheme); err != nil {
+		return
+	}
+	uc.Dialer = spec.Dialer
+	if uc.Dialer == UnixDialer {
+		var socket, path string
+		if socket, path, err = splitUnixHost(uc.Host); err == nil {
+			uc.SocketPath = socket
+			uc.Url = (&url.URL{Scheme: spec.UrlScheme, Host: unixHost, Path: path}).String()
+		}
 		return
 	}
 	hostElems := strings.SplitN(uc.Host, Slash, 2)
+	port, ok := uc.Port.Number()
+	if uc.Port.IsAuto() {
+		port, ok = spec.DefaultPort, true
+	}
+	uc.ResolvedPort = port
 	var h string
-	if omitPort(sc, uc.Port) {
+	if !ok || spec.omitPort(port) {
 		h = hostElems[0]
+		if urlSpec, found := lookupScheme(spec.UrlScheme); found {
+			uc.ResolvedPort = urlSpec.DefaultPort
+		}
 	} else {
 		var p nnet.Port
-		if p, err = nnet.NewPort(uc.Port); err == nil {
+		if p, err = nnet.NewPort(port); err == nil {
 			h = p.Addr(hostElems[0])
 		} else {
 			return
 		}
 	}
-	u := &url.URL{Scheme: sc, Host: h}
+	u := &url.URL{Scheme: spec.UrlScheme, Host: h}
 	if len(hostElems) > 1 {
 		u.Path = Slash + hostElems[1]
 	}
@@ -72,16 +94,23 @@ func (uc *UrlConfig) finalize() (err error) {
 	return
 }
 
-func validScheme(scheme string) (s string, err error) {
-	s = strings.ToLower(scheme)
-	if ok := validSchemes[s]; !ok {
+func validScheme(scheme string) (spec *SchemeSpec, err error) {
+	var ok bool
+	if spec, ok = lookupScheme(strings.ToLower(scheme)); !ok {
 		err = fmt.Errorf("invalid scheme: %s", scheme)
 	}
 	return
 }
 
-func omitPort(scheme string, port uint64) bool {
-	return port == IgnorePort ||
-		(scheme == Http) && (port == DefaultHttpPort) ||
-		(scheme == Https) && (port == DefaultHttpsPort)
+// splitUnixHost splits the host of a unix domain socket UrlConfig into the socket path and the request
+// path, separated by a colon (e.g. /var/run/prometheus.sock:/prometheus)
+func splitUnixHost(host string) (socket, path string, err error) {
+	socket, path, _ = strings.Cut(host, ":")
+	switch {
+	case socket == Empty:
+		err = fmt.Errorf("invalid unix host %s: the socket path must be set", host)
+	case path != Empty && !strings.HasPrefix(path, Slash):
+		err = fmt.Errorf("invalid unix host %s: the request path must be absolute", host)
+	}
+	return
 }
@@ -0,0 +1,43 @@
+package config
+
+import "testing"
+
+func TestUrlConfigFinalize(t *testing.T) {
+	tests := []struct {
+		name   string
+		uc     UrlConfig
+		url    string
+		socket string
+		err    bool
+	}{
+		{name: "http default port", uc: UrlConfig{Scheme: Http, Host: "prom"}, url: "http://prom"},
+		{name: "https port", uc: UrlConfig{Scheme: Https, Host: "prom", Port: NewPort(8443)}, url: "https://prom:8443"},
+		{name: "host path", uc: UrlConfig{Scheme: Https, Host: "prom/prometheus"}, url: "https://prom/prometheus"},
+		{name: "no port", uc: UrlConfig{Scheme: Http, Host: "prom", Port: NoPort}, url: "http://prom"},
+		{name: "h2c", uc: UrlConfig{Scheme: H2c, Host: "densify", Port: NewPort(8080)}, url: "http://densify:8080"},
+		{name: "unix", uc: UrlConfig{Scheme: Unix, Host: "/var/run/prom.sock"}, url: "http://localhost", socket: "/var/run/prom.sock"},
+		{name: "unix path", uc: UrlConfig{Scheme: Unix, Host: "/var/run/prom.sock:/prometheus"}, url: "http://localhost/prometheus", socket: "/var/run/prom.sock"},
+		{name: "unix relative path", uc: UrlConfig{Scheme: Unix, Host: "/var/run/prom.sock:prometheus"}, err: true},
+		{name: "unix no socket", uc: UrlConfig{Scheme: Unix, Host: ":/prometheus"}, err: true},
+		{name: "invalid scheme", uc: UrlConfig{Scheme: "ftp", Host: "prom"}, err: true},
+		{name: "scheme only", uc: UrlConfig{Scheme: Http}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := tt.uc
+			err := uc.finalize()
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got url %s", uc.Url)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if uc.Url != tt.url || uc.SocketPath != tt.socket {
+				t.Errorf("got url %s socket %s, want %s %s", uc.Url, uc.SocketPath, tt.url, tt.socket)
+			}
+		})
+	}
+}
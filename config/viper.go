@@ -1,8 +1,12 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
+	"os"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/go-viper/encoding/javaproperties"
 	"github.com/spf13/pflag"
@@ -13,9 +17,22 @@ import (
 const (
 	debug              = "debug"
 	configDir          = "config_dir"
+	config             = "config"
 	configFile         = "config_file"
 	configType         = "config_type"
+	configOverlay      = "config_overlay"
+	profile            = "profile"
+	configNoExpand     = "config_no_expand"
+	allowMixedConfig   = "allow_mixed_config"
+	configStrict       = "config_strict"
+	configUrl          = "config_url"
+	configUrlCache     = "config_url_cache"
+	configUrlSha256    = "config_url_sha256"
+	configUrlHmacKey   = "config_url_hmac_key"
 	clusterName        = "cluster_name"
+	clusterDisplayName = "cluster_display_name"
+	clusterDescription = "cluster_description"
+	clusterTags        = "cluster_tags"
 	promScheme         = "prometheus_protocol"
 	promHost           = "prometheus_address"
 	promPort           = "prometheus_port"
@@ -23,8 +40,10 @@ const (
 	promPassword       = "prometheus_password"
 	promToken          = "prometheus_oauth_token"
 	caCert             = "ca_certificate"
+	promFlavor         = "prometheus_flavor"
 	include            = "include_list"
 	nodeGroupList      = "node_group_list"
+	nodeGroupListExtra = "node_group_list_extra"
 	roleList           = "role_list"
 	interval           = "interval"
 	intervalSize       = "interval_size"
@@ -38,6 +57,7 @@ const (
 	densifyUser        = "user"
 	densifyPassword    = "password"
 	densifyEncPassword = "epassword"
+	densifyToken       = "token"
 	proxyScheme        = "proxyprotocol"
 	proxyHost          = "proxyhost"
 	proxyPort          = "proxyport"
@@ -50,25 +70,24 @@ const (
 	filePrefix         = "prefix"
 )
 
+// densifyKeys are the keys of the densify section
+var densifyKeys = []string{densifyScheme, densifyHost, densifyPort, densifyEndpoint, densifyUser, densifyPassword, densifyEncPassword, densifyToken}
+
 // default values as consts
 const (
 	defConfigDir              = "./config"
 	defConfigFile             = "config"
 	defConfigType             = "properties"
 	defPromScheme             = Http
-	defPromPort        uint64 = 9090
+	defPromHttpPort    uint64 = 9090
 	defInclude                = "container,node,cluster,nodegroup,quota"
-	defNodeGroupList          = "label_labeler_kubex_ai_node_group,label_worker_gardener_cloud_pool,label_karpenter_sh_nodepool,label_cloud_google_com_gke_nodepool,label_eks_amazonaws_com_nodegroup,label_agentpool,label_pool_name,label_alpha_eksctl_io_nodegroup_name,label_kops_k8s_io_instancegroup"
 	defRoleList               = "control-plane,master,infra,worker"
-	defInterval               = "hours"
+	defInterval               = Hours
 	defIntervalSize    uint64 = 1
-	defSampleRate      uint64 = 5
 	defHistory         uint64 = 1
-	defDensifyPort            = DefaultHttpsPort
 	defDensifyScheme          = Https
 	defDensifyHost            = "localhost"
 	defDensifyEndpoint        = "/api/v2/"
-	defProxyPort              = DefaultHttpsPort
 	defProxyAuth              = "Basic"
 )
 
@@ -76,17 +95,35 @@ const (
 var (
 	defOffset uint64
 	defDebug  bool
+	defPort   Port
+	// defSampleRate is 5 minutes
+	defSampleRate = SampleRate(5 * time.Minute)
 )
 
+// default node group label names, in priority order
+var defNodeGroupLabels = StringList{
+	"label_labeler_kubex_ai_node_group",
+	"label_worker_gardener_cloud_pool",
+	"label_karpenter_sh_nodepool",
+	"label_cloud_google_com_gke_nodepool",
+	"label_eks_amazonaws_com_nodegroup",
+	"label_agentpool",
+	"label_pool_name",
+	"label_alpha_eksctl_io_nodegroup_name",
+	"label_kops_k8s_io_instancegroup",
+}
+
 type valueSpec struct {
 	name      string
 	shorthand string
 	usage     string
 	v         *viper.Viper
+	// env is the environment variable of the value, if empty it is the name with the env prefix of v
+	env string
 }
 
-type pflagFunc[T comparable] func(*T, string, string, T, string)
-type getFunc[T comparable] func(*viper.Viper, string) T
+type pflagFunc[T comparable] func(*pflag.FlagSet, *T, string, string, T, string)
+type getFunc[T comparable] func(*viper.Viper, string) (T, error)
 
 type value[T comparable] struct {
 	spec  *valueSpec
@@ -95,63 +132,96 @@ type value[T comparable] struct {
 	pf    pflagFunc[T]
 	gf    getFunc[T]
 	isSet bool
+	// inFile indicates the value was read from the properties config file
+	inFile bool
 }
 
 type values[T comparable] map[string]*value[T]
 
 type parameterMap struct {
-	keys         map[string]bool
-	stringValues values[string]
-	uint64Values values[uint64]
-	boolValues   values[bool]
-	fromFile     bool
+	vipers         []*viper.Viper
+	vipersByPrefix map[string]*viper.Viper
+	keys           map[string]bool
+	stringValues   values[string]
+	uint64Values   values[uint64]
+	boolValues     values[bool]
+	portValues     values[Port]
+	rateValues     values[SampleRate]
+	sets           []string
+	overrides      []*override
+	secret         map[string]string
+	// mixed indicates the properties config file was layered on top of the yaml one
+	mixed bool
 }
 
 func initParameterMap() *parameterMap {
+	vs, vbp := initVipers()
 	pm := &parameterMap{
-		keys:         make(map[string]bool),
-		stringValues: make(values[string]),
-		uint64Values: make(values[uint64]),
-		boolValues:   make(values[bool]),
+		vipers:         vs,
+		vipersByPrefix: vbp,
+		keys:           make(map[string]bool),
+		stringValues:   make(values[string]),
+		uint64Values:   make(values[uint64]),
+		boolValues:     make(values[bool]),
+		portValues:     make(values[Port]),
+		rateValues:     make(values[SampleRate]),
 	}
 	// config file parameters
+	_ = pm.addStringValue(config, Empty, "config file path, or its parent directory (takes precedence over config_dir and config_file)", Empty, Empty)
+	// the generic CONFIG environment variable is too likely to be set for other purposes
+	pm.stringValues[config].spec.env = ConfigEnv
 	_ = pm.addStringValue(configDir, "l", "config file parent directory", Empty, defConfigDir)
 	_ = pm.addStringValue(configFile, "f", "config file name (without extension)", Empty, defConfigFile)
 	_ = pm.addStringValue(configType, "y", "config file type", Empty, defConfigType)
+	_ = pm.addStringValue(configOverlay, Empty, "comma-separated list of yaml config files to deep-merge, in order, on top of the config file", Empty, Empty)
+	_ = pm.addStringValue(profile, Empty, "name of the yaml config profile (an entry of the profiles map) to merge on top of the config file", Empty, Empty)
+	_ = pm.addBoolValue(configNoExpand, Empty, "disable expansion of ${VAR} and ${VAR:-default} environment variables in the yaml config", Empty, false)
+	_ = pm.addBoolValue(configStrict, Empty, "reject unknown fields in the yaml, json or toml config", Empty, false)
+	_ = pm.addStringValue(configUrl, Empty, "http(s) url of a remote yaml config, which the local config is merged on top of", Empty, Empty)
+	_ = pm.addStringValue(configUrlCache, Empty, "path of the remote config cache file (a verified remote config only), used when the remote config url is unreachable", Empty, Empty)
+	_ = pm.addStringValue(configUrlSha256, Empty, "expected sha256 checksum (hex) of the remote config", Empty, Empty)
+	_ = pm.addStringValue(configUrlHmacKey, Empty, "key verifying the HMAC-SHA256 signature of the remote config - value or filename", Empty, Empty)
+	_ = pm.addBoolValue(allowMixedConfig, Empty, "read the properties config file (same directory and name) as deprecated overrides on top of the yaml config", Empty, false)
 	// debug parameter
 	_ = pm.addBoolValue(debug, "d", "enable debug-level logging", Empty, defDebug)
 	// single cluster parameter
 	_ = pm.addStringValue(clusterName, "c", "cluster name", Empty, Empty)
+	_ = pm.addStringValue(clusterDisplayName, Empty, "cluster display name", Empty, Empty)
+	_ = pm.addStringValue(clusterDescription, Empty, "cluster description", Empty, Empty)
+	_ = pm.addStringValue(clusterTags, Empty, "comma-separated list of cluster tags as key=value (e.g. cost_center=42,env=prod)", Empty, Empty)
 	// prometheus parameters
 	_ = pm.addStringValue(promScheme, "s", "prometheus scheme", Empty, defPromScheme)
 	_ = pm.addStringValue(promHost, "a", "prometheus host", Empty, Empty)
-	_ = pm.addUint64Value(promPort, "p", "prometheus port", Empty, defPromPort)
+	_ = pm.addPortValue(promPort, "p", "prometheus port - number, auto (9090 for http, scheme default otherwise) or none", Empty, defPort)
 	_ = pm.addStringValue(promUser, "u", "prometheus basic auth user - value or filename", Empty, Empty)
 	_ = pm.addStringValue(promPassword, "w", "prometheus basic auth password - value or filename", Empty, Empty)
 	_ = pm.addStringValue(promToken, "t", "prometheus oauth token - value or filename", Empty, Empty)
 	_ = pm.addStringValue(caCert, "x", "path to CA certificate (may be required to pass certificate validation)", Empty, Empty)
+	_ = pm.addStringValue(promFlavor, Empty, "prometheus flavor - prometheus, thanos, victoriametrics, mimir, amp, grafana-cloud, or detect to probe it", Empty, Empty)
 	// collection parameters
 	_ = pm.addStringValue(include, "n", "comma-separated list of data to include in collection: cluster, node, container, nodegroup, quota", Empty, defInclude)
-	_ = pm.addStringValue(nodeGroupList, "g", "comma-separated list of label names to check for building node groups", Empty, defNodeGroupList)
+	_ = pm.addStringValue(nodeGroupList, "g", "comma-separated list of label names to check for building node groups, in priority order", Empty, defNodeGroupLabels.String())
+	_ = pm.addStringValue(nodeGroupListExtra, Empty, "comma-separated list of label names to check for building node groups, appended to node_group_list", Empty, Empty)
 	_ = pm.addStringValue(roleList, "q", "comma-separated list of role names to check for building node groups", Empty, defRoleList)
 	_ = pm.addStringValue(interval, "k", "interval unit - days/hours/minutes", Empty, defInterval)
 	_ = pm.addUint64Value(intervalSize, "i", "interval size to be used for querying - last interval size of interval unit of data", Empty, defIntervalSize)
-	_ = pm.addUint64Value(sampleRate, "r", "rate of sample points to collect (1 sample every sample rate in minutes)", Empty, defSampleRate)
+	_ = pm.addSampleRateValue(sampleRate, "r", "rate of sample points to collect - duration (e.g. 30s, 5m) or number of minutes", Empty, defSampleRate)
 	_ = pm.addUint64Value(history, "h", "time to go back for data collection, works with the interval and interval size settings", Empty, defHistory)
 	_ = pm.addUint64Value(offset, "o", "amount of units (based on interval value) to offset the data collection backwards in time", Empty, defOffset)
 	// forwarder parameters
 	// 		Densify parameters
 	_ = pm.addStringValue(densifyScheme, "S", "densify scheme", forwarderEnvPrefix, defDensifyScheme)
 	_ = pm.addStringValue(densifyHost, "H", "densify host", forwarderEnvPrefix, defDensifyHost)
-	_ = pm.addUint64Value(densifyPort, "P", "densify port", forwarderEnvPrefix, defDensifyPort)
+	_ = pm.addPortValue(densifyPort, "P", "densify port - number, auto (scheme default) or none", forwarderEnvPrefix, defPort)
 	_ = pm.addStringValue(densifyEndpoint, "N", "densify endpoint", forwarderEnvPrefix, defDensifyEndpoint)
 	_ = pm.addStringValue(densifyUser, "U", "densify user - value or filename", forwarderEnvPrefix, Empty)
 	_ = pm.addStringValue(densifyPassword, "W", "densify password - value or filename", forwarderEnvPrefix, Empty)
 	_ = pm.addStringValue(densifyEncPassword, "E", "encrypted densify password - value or filename", forwarderEnvPrefix, Empty)
+	_ = pm.addStringValue(densifyToken, Empty, "densify api token (instead of user and password) - value or filename", forwarderEnvPrefix, Empty)
 	// 		proxy parameters
 	_ = pm.addStringValue(proxyScheme, "T", "proxy scheme", forwarderEnvPrefix, Empty)
 	_ = pm.addStringValue(proxyHost, "G", "proxy host", forwarderEnvPrefix, Empty)
-	_ = pm.addUint64Value(proxyPort, "Q", "proxy port", forwarderEnvPrefix, defProxyPort)
+	_ = pm.addPortValue(proxyPort, "Q", "proxy port - number, auto (scheme default) or none", forwarderEnvPrefix, defPort)
 	_ = pm.addStringValue(proxyAuth, "A", "proxy auth", forwarderEnvPrefix, defProxyAuth)
 	_ = pm.addStringValue(proxyServer, "R", "proxy server", forwarderEnvPrefix, Empty)
 	_ = pm.addStringValue(proxyDomain, "D", "proxy domain", forwarderEnvPrefix, Empty)
@@ -164,31 +234,63 @@ func initParameterMap() *parameterMap {
 	return pm
 }
 
-func getString(v *viper.Viper, key string) string {
-	return v.GetString(key)
+func getString(v *viper.Viper, key string) (string, error) {
+	return v.GetString(key), nil
 }
 
 func (pm *parameterMap) addStringValue(name, shorthand, usage string, envPrefix string, defV string) error {
-	return addValue(pm.keys, pm.stringValues, name, shorthand, usage, envPrefix, defV, pflag.StringVarP, getString)
+	return addValue(pm.vipersByPrefix, pm.keys, pm.stringValues, name, shorthand, usage, envPrefix, defV, (*pflag.FlagSet).StringVarP, getString)
 }
 
-func getUint64(v *viper.Viper, key string) uint64 {
-	return v.GetUint64(key)
+func getUint64(v *viper.Viper, key string) (uint64, error) {
+	return v.GetUint64(key), nil
 }
 
 func (pm *parameterMap) addUint64Value(name, shorthand, usage string, envPrefix string, defV uint64) error {
-	return addValue(pm.keys, pm.uint64Values, name, shorthand, usage, envPrefix, defV, pflag.Uint64VarP, getUint64)
+	return addValue(pm.vipersByPrefix, pm.keys, pm.uint64Values, name, shorthand, usage, envPrefix, defV, (*pflag.FlagSet).Uint64VarP, getUint64)
 }
 
-func getBool(v *viper.Viper, key string) bool {
-	return v.GetBool(key)
+func getBool(v *viper.Viper, key string) (bool, error) {
+	return v.GetBool(key), nil
 }
 
 func (pm *parameterMap) addBoolValue(name, shorthand, usage string, envPrefix string, defV bool) error {
-	return addValue(pm.keys, pm.boolValues, name, shorthand, usage, envPrefix, defV, pflag.BoolVarP, getBool)
+	return addValue(pm.vipersByPrefix, pm.keys, pm.boolValues, name, shorthand, usage, envPrefix, defV, (*pflag.FlagSet).BoolVarP, getBool)
+}
+
+func portVarP(fs *pflag.FlagSet, p *Port, name, shorthand string, value Port, usage string) {
+	*p = value
+	fs.VarP(p, name, shorthand, usage)
+}
+
+func getPort(v *viper.Viper, key string) (p Port, err error) {
+	if p, err = ParsePort(v.GetString(key)); err != nil {
+		err = fmt.Errorf("%s: %w", key, err)
+	}
+	return
+}
+
+func (pm *parameterMap) addPortValue(name, shorthand, usage string, envPrefix string, defV Port) error {
+	return addValue(pm.vipersByPrefix, pm.keys, pm.portValues, name, shorthand, usage, envPrefix, defV, portVarP, getPort)
+}
+
+func sampleRateVarP(fs *pflag.FlagSet, sr *SampleRate, name, shorthand string, value SampleRate, usage string) {
+	*sr = value
+	fs.VarP(sr, name, shorthand, usage)
 }
 
-func addValue[T comparable](keys map[string]bool, vals values[T], name, shorthand, usage string, envPrefix string, defV T, pf pflagFunc[T], gf getFunc[T]) error {
+func getSampleRate(v *viper.Viper, key string) (sr SampleRate, err error) {
+	if sr, err = ParseSampleRate(v.GetString(key)); err != nil {
+		err = fmt.Errorf("%s: %w", key, err)
+	}
+	return
+}
+
+func (pm *parameterMap) addSampleRateValue(name, shorthand, usage string, envPrefix string, defV SampleRate) error {
+	return addValue(pm.vipersByPrefix, pm.keys, pm.rateValues, name, shorthand, usage, envPrefix, defV, sampleRateVarP, getSampleRate)
+}
+
+func addValue[T comparable](vipersByPrefix map[string]*viper.Viper, keys map[string]bool, vals values[T], name, shorthand, usage string, envPrefix string, defV T, pf pflagFunc[T], gf getFunc[T]) error {
 	if keys[name] {
 		return fmt.Errorf("duplicate key %s", name)
 	}
@@ -217,14 +319,20 @@ const (
 )
 
 var envPrefixes = []string{Empty, forwarderEnvPrefix}
-var vipers, vipersByPrefix = initVipers()
+var codecRegistry = initCodecRegistry()
+
+// initCodecRegistry returns viper's codec registry (which supports yaml, json and toml) with properties added
+func initCodecRegistry() *viper.DefaultCodecRegistry {
+	cr := viper.NewCodecRegistry()
+	_ = cr.RegisterCodec(defConfigType, &javaproperties.Codec{})
+	_ = cr.RegisterCodec(propsType, &javaproperties.Codec{})
+	return cr
+}
 
 func initVipers() (vs []*viper.Viper, m map[string]*viper.Viper) {
 	l := len(envPrefixes)
 	vs = make([]*viper.Viper, l)
 	m = make(map[string]*viper.Viper, l)
-	codecRegistry := viper.NewCodecRegistry()
-	codecRegistry.RegisterCodec(defConfigType, &javaproperties.Codec{})
 	for i, envPrefix := range envPrefixes {
 		v := viper.NewWithOptions(viper.WithCodecRegistry(codecRegistry))
 		v.SetTypeByDefaultValue(true)
@@ -236,45 +344,86 @@ func initVipers() (vs []*viper.Viper, m map[string]*viper.Viper) {
 	return
 }
 
-func (pm *parameterMap) populate() (fc *fileConfig, err error) {
-	if err = populateValues(pm.stringValues); err == nil {
-		if err = populateValues(pm.uint64Values); err == nil {
-			err = populateValues(pm.boolValues)
+// populate defines the flags in fs, parses args and reads the properties config file (if any)
+func (pm *parameterMap) populate(fs *pflag.FlagSet, o *options) (fc *fileConfig, err error) {
+	if err = populateValues(fs, pm.stringValues); err == nil {
+		if err = populateValues(fs, pm.uint64Values); err == nil {
+			if err = populateValues(fs, pm.boolValues); err == nil {
+				if err = populateValues(fs, pm.portValues); err == nil {
+					err = populateValues(fs, pm.rateValues)
+				}
+			}
 		}
 	}
 	if err != nil {
 		return
 	}
-	pflag.Parse()
-	for _, v := range vipers {
-		if err = v.BindPFlags(pflag.CommandLine); err != nil {
+	addSetFlag(fs, &pm.sets)
+	if err = fs.Parse(o.args); err != nil {
+		return
+	}
+	for _, v := range pm.vipers {
+		if err = v.BindPFlags(fs); err != nil {
 			return
 		}
 	}
 	// the meta config (config path, filename and type) are only available at the first Viper instance
-	fc = getFileConfig(vipers[0])
-	for _, v := range vipers {
-		if fc.configType() == mapType {
-			v.SetConfigName(fc.file)
+	fc = getFileConfig(pm.vipers[0])
+	o.apply(fc)
+	if err = fc.discover(); err != nil {
+		return
+	}
+	for _, v := range pm.vipers {
+		if fc.path() == Empty {
+			break
+		}
+		switch fc.configType() {
+		case mapType:
 			v.SetConfigType(fc.typ)
-			v.AddConfigPath(fc.dir)
-			e := v.ReadInConfig()
-			pm.fromFile = e == nil
+			if fc.data != nil {
+				_ = v.ReadConfig(bytes.NewReader(fc.data))
+			} else {
+				v.SetConfigFile(fc.path())
+				_ = v.ReadInConfig()
+			}
+		case hierarchyType:
+			// in mixed mode, the properties config file is layered on top of the yaml one
+			if !fc.allowMixed || fc.data != nil {
+				continue
+			}
+			v.SetConfigFile(fc.propertiesPath())
+			v.SetConfigType(defConfigType)
+			if v.ReadInConfig() == nil {
+				pm.mixed = true
+			}
 		}
 	}
 	// resolve the values
-	resolve(pm.stringValues)
-	resolve(pm.uint64Values)
-	resolve(pm.boolValues)
+	if err = resolve(pm.stringValues); err == nil {
+		if err = resolve(pm.uint64Values); err == nil {
+			if err = resolve(pm.boolValues); err == nil {
+				if err = resolve(pm.portValues); err == nil {
+					if err = resolve(pm.rateValues); err == nil {
+						pm.overrides, err = getOverrides(os.Environ(), pm.sets)
+						pm.secret = o.secret
+					}
+				}
+			}
+		}
+	}
 	return
 }
 
-func populateValues[T comparable](vals values[T]) error {
+func populateValues[T comparable](fs *pflag.FlagSet, vals values[T]) error {
 	// default values are used as defaults for pflag - if we'd call v.SetDefault(), then IsSet() for
 	// that key will always return true
 	for key, val := range vals {
-		val.pf(&val.v, val.spec.name, val.spec.shorthand, val.defV, val.spec.usage)
-		if err := val.spec.v.BindEnv([]string{key}...); err != nil {
+		val.pf(fs, &val.v, val.spec.name, val.spec.shorthand, val.defV, val.spec.usage)
+		input := []string{key}
+		if val.spec.env != Empty {
+			input = append(input, val.spec.env)
+		}
+		if err := val.spec.v.BindEnv(input...); err != nil {
 			return err
 		}
 	}
@@ -282,18 +431,80 @@ func populateValues[T comparable](vals values[T]) error {
 }
 
 func getFileConfig(v *viper.Viper) *fileConfig {
-	return &fileConfig{
-		dir:  v.GetString(configDir),
-		file: v.GetString(configFile),
-		typ:  strings.ToLower(v.GetString(configType)),
+	fc := &fileConfig{
+		dir:        v.GetString(configDir),
+		file:       v.GetString(configFile),
+		typ:        strings.ToLower(v.GetString(configType)),
+		profile:    v.GetString(profile),
+		noExpand:   v.GetBool(configNoExpand),
+		allowMixed: v.GetBool(allowMixedConfig),
+		strict:     v.GetBool(configStrict),
 	}
+	if overlays := v.GetString(configOverlay); overlays != Empty {
+		fc.overlays = strings.Split(overlays, Comma)
+	}
+	fc.typeSet = v.IsSet(configType)
+	if u := v.GetString(configUrl); u != Empty {
+		fc.remote = &remoteConfig{
+			url:       u,
+			cachePath: v.GetString(configUrlCache),
+			sha256:    v.GetString(configUrlSha256),
+		}
+		if vop, _ := NewValueOrPath(v.GetString(configUrlHmacKey), false, true); !vop.IsEmpty() {
+			fc.remote.hmacKey = strings.TrimSpace(vop.Value())
+		}
+	}
+	switch {
+	case v.IsSet(config):
+		fc.explicit = v.GetString(config)
+	case v.IsSet(configDir) || v.IsSet(configFile):
+		fc.explicit = fc.dir
+	}
+	return fc
 }
 
-func resolve[T comparable](vals values[T]) {
+func resolve[T comparable](vals values[T]) (err error) {
 	for key, val := range vals {
-		val.v = val.gf(val.spec.v, key)
+		if val.v, err = val.gf(val.spec.v, key); err != nil {
+			return
+		}
 		val.isSet = val.spec.v.IsSet(key)
+		val.inFile = val.spec.v.InConfig(key)
+	}
+	return
+}
+
+// fileKeys returns the sorted keys whose values were read from the properties config file
+func (pm *parameterMap) fileKeys() (keys []string) {
+	keys = appendFileKeys(keys, pm.stringValues)
+	keys = appendFileKeys(keys, pm.uint64Values)
+	keys = appendFileKeys(keys, pm.boolValues)
+	keys = appendFileKeys(keys, pm.portValues)
+	keys = appendFileKeys(keys, pm.rateValues)
+	slices.Sort(keys)
+	return
+}
+
+func appendFileKeys[T comparable](keys []string, vals values[T]) []string {
+	for key, val := range vals {
+		if val.inFile {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// anySet indicates whether any of the string or port keys is set
+func (pm *parameterMap) anySet(keys ...string) bool {
+	for _, key := range keys {
+		if val, ok := pm.stringValues[key]; ok && val.isSet {
+			return true
+		}
+		if val, ok := pm.portValues[key]; ok && val.isSet {
+			return true
+		}
 	}
+	return false
 }
 
 func (pm *parameterMap) finalize() {
@@ -0,0 +1,217 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	Days    = "days"
+	Hours   = "hours"
+	Minutes = "minutes"
+	// prometheusMaxPoints is the maximum number of points per series Prometheus returns for a range query
+	prometheusMaxPoints uint64 = 11000
+	// prometheusRetention is the default retention of Prometheus
+	prometheusRetention = 15 * 24 * time.Hour
+	// scrapeInterval is the usual scrape interval of Kubernetes Prometheus deployments
+	scrapeInterval = 30 * time.Second
+)
+
+var intervalUnits = map[string]time.Duration{
+	Days:    24 * time.Hour,
+	Hours:   time.Hour,
+	Minutes: time.Minute,
+}
+
+// WindowLimits bounds the collection window. Each limit set replaces the default one, a limit not set
+// (nil) keeps it, and a zero value means no limit
+type WindowLimits struct {
+	// MaxLookback is the maximum time to go back (history and offset), e.g. the retention of Prometheus
+	MaxLookback *time.Duration `yaml:"max_lookback,omitempty"`
+	// MaxPointsPerSeries is the maximum number of points per series of a single query
+	MaxPointsPerSeries *uint64 `yaml:"max_points_per_series,omitempty"`
+	// MaxQueries is the maximum number of queries per metric
+	MaxQueries *uint64 `yaml:"max_queries,omitempty"`
+	// MinScrapeInterval is the minimum sample rate, as a sample rate shorter than the scrape interval
+	// of Prometheus only repeats the scraped points
+	MinScrapeInterval *time.Duration `yaml:"min_scrape_interval,omitempty"`
+}
+
+// CollectionLimits holds the limits of the collection window: exceeding a soft limit is a warning,
+// exceeding a hard limit is an error
+type CollectionLimits struct {
+	Soft *WindowLimits `yaml:"soft,omitempty"`
+	Hard *WindowLimits `yaml:"hard,omitempty"`
+}
+
+var (
+	defSoftLimits = WindowLimits{MaxLookback: ptr(prometheusRetention)}
+	defHardLimits = WindowLimits{MaxPointsPerSeries: ptr(prometheusMaxPoints), MinScrapeInterval: ptr(scrapeInterval)}
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	return ptr(*p)
+}
+
+// limit returns the value of a limit, ok is false if it is not set or zero (no limit)
+func limit[T time.Duration | uint64](p *T) (v T, ok bool) {
+	if p != nil && *p > 0 {
+		v, ok = *p, true
+	}
+	return
+}
+
+// CollectionPlan summarizes the collection window
+type CollectionPlan struct {
+	// Window is the time range covered by each query
+	Window time.Duration `json:"window"`
+	// Step is the resolution of each query
+	Step time.Duration `json:"step"`
+	// Queries is the number of queries per metric
+	Queries uint64 `json:"queries"`
+	// PointsPerSeries is the number of points per series of each query
+	PointsPerSeries uint64 `json:"points_per_series"`
+	// TotalPointsPerSeries is the number of points per series of all queries
+	TotalPointsPerSeries uint64 `json:"total_points_per_series"`
+	// Offset is the time the collection window is shifted backwards by
+	Offset time.Duration `json:"offset"`
+	// Lookback is the time the collection goes back to, including the offset
+	Lookback time.Duration `json:"lookback"`
+	// Warnings lists the soft limits exceeded
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Plan computes the collection window and checks it against the limits; the error reports a window
+// which cannot be collected or exceeds a hard limit, in which case the plan is still returned if computed
+func (cp *CollectionParameters) Plan() (plan *CollectionPlan, err error) {
+	unit, ok := intervalUnits[strings.ToLower(cp.Interval)]
+	if !ok {
+		err = fmt.Errorf("invalid interval %s: must be one of %s, %s, %s", cp.Interval, Days, Hours, Minutes)
+		return
+	}
+	if cp.SampleRate <= 0 {
+		err = fmt.Errorf("sample_rate must be positive")
+		return
+	}
+	plan = &CollectionPlan{
+		Window:  time.Duration(cp.IntervalSize) * unit,
+		Step:    cp.SampleRate.Duration(),
+		Queries: cp.History,
+	}
+	plan.PointsPerSeries = uint64(plan.Window / plan.Step)
+	plan.TotalPointsPerSeries = plan.PointsPerSeries * plan.Queries
+	plan.Offset = time.Duration(cp.Offset) * unit
+	plan.Lookback = plan.runWindow() + plan.Offset
+	switch {
+	case plan.Queries == 0:
+		err = fmt.Errorf("history must be positive")
+	case plan.PointsPerSeries == 0:
+		err = fmt.Errorf("collection window of %v is shorter than the sample rate of %v, no samples would be collected", plan.Window, plan.Step)
+	default:
+		soft, hard := cp.limits()
+		plan.Warnings = plan.exceeded(soft)
+		if violations := plan.exceeded(hard); len(violations) > 0 {
+			err = fmt.Errorf("collection window exceeds hard limits: %s", strings.Join(violations, "; "))
+		}
+	}
+	return
+}
+
+// limits returns the effective limits: the default ones, with the limits set in the config replacing them
+func (cp *CollectionParameters) limits() (soft, hard *WindowLimits) {
+	var cs, ch *WindowLimits
+	if cp.Limits != nil {
+		cs, ch = cp.Limits.Soft, cp.Limits.Hard
+	}
+	return defSoftLimits.merge(cs), defHardLimits.merge(ch)
+}
+
+// merge returns a copy of wl with the limits set in o (if not nil) replacing its own
+func (wl WindowLimits) merge(o *WindowLimits) *WindowLimits {
+	if o != nil {
+		if o.MaxLookback != nil {
+			wl.MaxLookback = o.MaxLookback
+		}
+		if o.MaxPointsPerSeries != nil {
+			wl.MaxPointsPerSeries = o.MaxPointsPerSeries
+		}
+		if o.MaxQueries != nil {
+			wl.MaxQueries = o.MaxQueries
+		}
+		if o.MinScrapeInterval != nil {
+			wl.MinScrapeInterval = o.MinScrapeInterval
+		}
+	}
+	return &wl
+}
+
+func (cl *CollectionLimits) clone() *CollectionLimits {
+	if cl == nil {
+		return nil
+	}
+	return &CollectionLimits{Soft: cl.Soft.clone(), Hard: cl.Hard.clone()}
+}
+
+func (wl *WindowLimits) clone() *WindowLimits {
+	if wl == nil {
+		return nil
+	}
+	return &WindowLimits{
+		MaxLookback:        clonePtr(wl.MaxLookback),
+		MaxPointsPerSeries: clonePtr(wl.MaxPointsPerSeries),
+		MaxQueries:         clonePtr(wl.MaxQueries),
+		MinScrapeInterval:  clonePtr(wl.MinScrapeInterval),
+	}
+}
+
+func (plan *CollectionPlan) exceeded(wl *WindowLimits) (msgs []string) {
+	if l, ok := limit(wl.MaxLookback); ok && plan.Lookback > l {
+		msgs = append(msgs, fmt.Sprintf("lookback of %v exceeds %v", plan.Lookback, l))
+	}
+	if l, ok := limit(wl.MaxPointsPerSeries); ok && plan.PointsPerSeries > l {
+		msgs = append(msgs, fmt.Sprintf("%d points per series exceed %d", plan.PointsPerSeries, l))
+	}
+	if l, ok := limit(wl.MaxQueries); ok && plan.Queries > l {
+		msgs = append(msgs, fmt.Sprintf("%d queries exceed %d", plan.Queries, l))
+	}
+	if l, ok := limit(wl.MinScrapeInterval); ok && plan.Step < l {
+		msgs = append(msgs, fmt.Sprintf("sample rate of %v is shorter than the scrape interval of %v", plan.Step, l))
+	}
+	return
+}
+
+func (plan *CollectionPlan) String() string {
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "queries per metric: %d\n", plan.Queries)
+	_, _ = fmt.Fprintf(&sb, "query window: %v\n", plan.Window)
+	_, _ = fmt.Fprintf(&sb, "query step: %v\n", plan.Step)
+	_, _ = fmt.Fprintf(&sb, "points per series per query: %d\n", plan.PointsPerSeries)
+	_, _ = fmt.Fprintf(&sb, "points per series in total: %d\n", plan.TotalPointsPerSeries)
+	_, _ = fmt.Fprintf(&sb, "offset: %v\n", plan.Offset)
+	_, _ = fmt.Fprintf(&sb, "lookback: %v\n", plan.Lookback)
+	for _, w := range plan.Warnings {
+		_, _ = fmt.Fprintf(&sb, "warning: %s\n", w)
+	}
+	return sb.String()
+}
+
+// validateWindow checks the collection window and the schedule, and returns the soft limits exceeded
+func (cp *CollectionParameters) validateWindow() (warnings []string, err error) {
+	var plan *CollectionPlan
+	if plan, err = cp.Plan(); err != nil {
+		return
+	}
+	warnings = plan.Warnings
+	if cp.Schedule != nil {
+		err = cp.Schedule.validate(plan.runWindow())
+	}
+	return
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		limits   *CollectionLimits
+		lookback *time.Duration
+		queries  *uint64
+		points   *uint64
+	}{
+		{name: "defaults", lookback: ptr(prometheusRetention), points: ptr(prometheusMaxPoints)},
+		{name: "soft per key", limits: &CollectionLimits{Soft: &WindowLimits{MaxQueries: ptr(uint64(24))}}, lookback: ptr(prometheusRetention), queries: ptr(uint64(24)), points: ptr(prometheusMaxPoints)},
+		{name: "zero disables", limits: &CollectionLimits{Soft: &WindowLimits{MaxLookback: ptr(time.Duration(0))}}, lookback: ptr(time.Duration(0)), points: ptr(prometheusMaxPoints)},
+		{name: "hard per key", limits: &CollectionLimits{Hard: &WindowLimits{MaxPointsPerSeries: ptr(uint64(100))}}, lookback: ptr(prometheusRetention), points: ptr(uint64(100))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			soft, hard := (&CollectionParameters{Limits: tt.limits}).limits()
+			if !equalPtr(soft.MaxLookback, tt.lookback) || !equalPtr(soft.MaxQueries, tt.queries) || !equalPtr(hard.MaxPointsPerSeries, tt.points) {
+				t.Errorf("got soft %+v, hard %+v", soft, hard)
+			}
+		})
+	}
+	if *defSoftLimits.MaxLookback != prometheusRetention {
+		t.Error("the default limits were modified")
+	}
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	return a == b || a != nil && b != nil && *a == *b
+}
+
+func TestSoftLimitWarnings(t *testing.T) {
+	yamlDoc := baseYaml + `    collection:
+      offset: 1
+  - name: c1
+    collection:
+      history: 400
+collection:
+  history: 400
+`
+	logs := captureLogs(t)
+	if _, err := loadDir(t, map[string]string{"config.yaml": yamlDoc}); err != nil {
+		t.Fatal(err)
+	}
+	// c0 exceeds the max lookback by more than the global collection, c1 by as much
+	out := logs.String()
+	if n := strings.Count(out, "exceeds soft limit"); n != 2 {
+		t.Errorf("got %d soft limit warnings, want 2:\n%s", n, out)
+	}
+	if !strings.Contains(out, "cluster=c0") || strings.Contains(out, "cluster=c1") {
+		t.Errorf("got warnings:\n%s", out)
+	}
+}
+
+func TestSampleRateSt(t *testing.T) {
+	tests := []struct {
+		rate SampleRate
+		want string
+	}{
+		{SampleRate(5 * time.Minute), "5"},
+		{SampleRate(2 * time.Minute), "2"},
+		{SampleRate(90 * time.Second), "2"},
+		{SampleRate(30 * time.Second), "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rate.String(), func(t *testing.T) {
+			cp := &CollectionParameters{Interval: Hours, IntervalSize: 1, History: 1, SampleRate: tt.rate}
+			if _, err := cp.finalize(); err != nil {
+				t.Fatal(err)
+			}
+			if cp.SampleRateSt != tt.want {
+				t.Errorf("got %q, want %q", cp.SampleRateSt, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinScrapeInterval(t *testing.T) {
+	cp := &CollectionParameters{Interval: Hours, IntervalSize: 1, History: 1, SampleRate: SampleRate(15 * time.Second)}
+	if _, err := cp.finalize(); err == nil {
+		t.Error("expected a sample rate shorter than the scrape interval to be rejected")
+	}
+	cp.Limits = &CollectionLimits{Hard: &WindowLimits{MinScrapeInterval: ptr(15 * time.Second)}}
+	if _, err := cp.finalize(); err != nil {
+		t.Error(err)
+	}
+}
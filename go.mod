@@ -5,6 +5,7 @@ go 1.26.5
 require (
 	github.com/densify-dev/net-utils v1.0.10
 	github.com/go-viper/encoding/javaproperties v0.1.0
+	github.com/golang-jwt/jwt/v5 v5.3.1
 	github.com/prometheus/common v0.69.0
 	github.com/prometheus/sigv4 v0.4.1
 	github.com/spf13/pflag v1.0.10
@@ -31,7 +32,6 @@ require (
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/fsnotify/fsnotify v1.10.1 // indirect
 	github.com/go-viper/mapstructure/v2 v2.5.0 // indirect
-	github.com/golang-jwt/jwt/v5 v5.3.1 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/hashicorp/go-cleanhttp v0.5.2 // indirect
 	github.com/hashicorp/go-retryablehttp v0.7.8 // indirect